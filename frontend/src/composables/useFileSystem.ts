@@ -1,11 +1,12 @@
 import { ref, computed } from "vue";
-import type { FileInfo } from "../types";
+import type { FileInfo, TransferState } from "../types";
 
 export function useFileSystem() {
   const files = ref<FileInfo[]>([]);
   const watchDir = ref<string>("");
   const isLoading = ref<boolean>(false);
   const error = ref<string | null>(null);
+  const transferState = ref<TransferState>("active");
 
   const syncedFile = computed(() =>
     files.value.filter((file) => file.Status === "SYNCED")
@@ -43,6 +44,20 @@ export function useFileSystem() {
     }
   };
 
+  const loadTransferState = async () => {
+    try {
+      if (await window.go.main.App.IsPausing()) {
+        transferState.value = "pausing";
+      } else if (await window.go.main.App.IsPaused()) {
+        transferState.value = "paused";
+      } else {
+        transferState.value = "active";
+      }
+    } catch (e) {
+      console.error("Failed to get transfer state:", e);
+    }
+  };
+
   const getWatchDir = async () => {
     try {
       watchDir.value = await window.go.main.App.GetWatchDir();
@@ -70,6 +85,32 @@ export function useFileSystem() {
     }
   };
 
+  const makeAvailableOffline = async (path: string) => {
+    error.value = null;
+
+    try {
+      await window.go.main.App.MakeAvailableOffline(path);
+      return true;
+    } catch (e) {
+      console.error("Failed to make file available offline:", e);
+      error.value = "Failed to make file available offline";
+      return false;
+    }
+  };
+
+  const freeUpSpace = async (path: string) => {
+    error.value = null;
+
+    try {
+      await window.go.main.App.FreeUpSpace(path);
+      return true;
+    } catch (e) {
+      console.error("Failed to free up space:", e);
+      error.value = "Failed to free up space";
+      return false;
+    }
+  };
+
   const minimizeToTray = async () => {
     try {
       window.go.main.App.MinimizeToTray();
@@ -85,11 +126,15 @@ export function useFileSystem() {
     watchDir,
     isLoading,
     error,
+    transferState,
     getFileName,
     formatFileSize,
     loadFiles,
+    loadTransferState,
     getWatchDir,
     setWatchDir,
+    makeAvailableOffline,
+    freeUpSpace,
     minimizeToTray,
   };
 }
@@ -1,13 +1,18 @@
 export interface FileInfo {
   Path: string;
-  Status: "NOT_SYNCED" | "SYNCING" | "SYNCED" | "ERROR";
+  Status: "NOT_SYNCED" | "SYNCING" | "SYNCED" | "ERROR" | "CONFLICT";
   LastModified: string;
   Size: number;
   IsDownloaded: boolean;
   IsDirectory: boolean;
   FilesContent: FileInfo[];
+  Error?: string;
+  Retries?: number;
+  NextRetry?: string;
 }
 
+export type TransferState = "active" | "pausing" | "paused";
+
 export interface SyncState {
   watchDir: string;
   files: FileInfo[];
@@ -9,6 +9,10 @@ declare global {
           GetWatchDir(): Promise<string>;
           SetWatchDir(dir: string): Promise<void>;
           MinimizeToTray(): Promise<void>;
+          MakeAvailableOffline(path: string): Promise<void>;
+          FreeUpSpace(path: string): Promise<void>;
+          IsPaused(): Promise<boolean>;
+          IsPausing(): Promise<boolean>;
         };
       };
     };
@@ -2,18 +2,74 @@
 // This file is automatically generated. DO NOT EDIT
 import {models} from '../models';
 
+export function AddWatchDir(arg1:string,arg2:string):Promise<void>;
+
+export function ConfirmDeletions():Promise<void>;
+
 export function Connect(arg1:string,arg2:string):Promise<void>;
 
+export function ExplainIgnored(arg1:string):Promise<models.IgnoreMatch>;
+
+export function FreeUpSpace(arg1:string):Promise<void>;
+
+export function GetBandwidthLimits():Promise<models.BandwidthLimits>;
+
+export function GetBandwidthProfiles():Promise<Array<models.BandwidthProfile>>;
+
+export function GetConflicts():Promise<Array<models.Conflict>>;
+
 export function GetFiles():Promise<Array<models.FileInfo>>;
 
+export function GetPendingDeletions():Promise<Array<string>>;
+
+export function GetSchedule():Promise<models.SyncSchedule>;
+
+export function GetSyncFolders():Promise<Array<models.SyncFolder>>;
+
 export function GetWatchDir():Promise<string>;
 
 export function IsConnected():Promise<boolean>;
 
+export function IsOnDemand():Promise<boolean>;
+
+export function IsPaused():Promise<boolean>;
+
+export function IsPausing():Promise<boolean>;
+
+export function ListRemoteFolders(arg1:string):Promise<Array<models.RemoteFolder>>;
+
+export function MakeAvailableOffline(arg1:string):Promise<void>;
+
 export function MinimizeToTray():Promise<void>;
 
+export function PauseSync():Promise<void>;
+
+export function RemoveLocalCopy(arg1:string):Promise<void>;
+
+export function RemoveWatchDir(arg1:string):Promise<void>;
+
+export function Rescan():Promise<void>;
+
+export function ResolveConflict(arg1:string,arg2:string):Promise<void>;
+
+export function RestoreDeletions():Promise<void>;
+
+export function ResumeSync():Promise<void>;
+
+export function SetBandwidthLimits(arg1:models.BandwidthLimits):Promise<void>;
+
+export function SetBandwidthProfiles(arg1:Array<models.BandwidthProfile>):Promise<void>;
+
+export function SetFolderSelected(arg1:string,arg2:boolean):Promise<void>;
+
+export function SetOnDemand(arg1:boolean):Promise<void>;
+
+export function SetSchedule(arg1:models.SyncSchedule):Promise<void>;
+
 export function SetWatchDir(arg1:string):Promise<void>;
 
 export function SetupSystemTray():Promise<void>;
 
 export function Shutdown():Promise<void>;
+
+export function SyncNow():Promise<void>;
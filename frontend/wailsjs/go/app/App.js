@@ -2,14 +2,54 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddWatchDir(arg1, arg2) {
+  return window['go']['app']['App']['AddWatchDir'](arg1, arg2);
+}
+
+export function ConfirmDeletions() {
+  return window['go']['app']['App']['ConfirmDeletions']();
+}
+
 export function Connect(arg1, arg2) {
   return window['go']['app']['App']['Connect'](arg1, arg2);
 }
 
+export function ExplainIgnored(arg1) {
+  return window['go']['app']['App']['ExplainIgnored'](arg1);
+}
+
+export function FreeUpSpace(arg1) {
+  return window['go']['app']['App']['FreeUpSpace'](arg1);
+}
+
+export function GetBandwidthLimits() {
+  return window['go']['app']['App']['GetBandwidthLimits']();
+}
+
+export function GetBandwidthProfiles() {
+  return window['go']['app']['App']['GetBandwidthProfiles']();
+}
+
+export function GetConflicts() {
+  return window['go']['app']['App']['GetConflicts']();
+}
+
 export function GetFiles() {
   return window['go']['app']['App']['GetFiles']();
 }
 
+export function GetPendingDeletions() {
+  return window['go']['app']['App']['GetPendingDeletions']();
+}
+
+export function GetSchedule() {
+  return window['go']['app']['App']['GetSchedule']();
+}
+
+export function GetSyncFolders() {
+  return window['go']['app']['App']['GetSyncFolders']();
+}
+
 export function GetWatchDir() {
   return window['go']['app']['App']['GetWatchDir']();
 }
@@ -18,10 +58,78 @@ export function IsConnected() {
   return window['go']['app']['App']['IsConnected']();
 }
 
+export function IsOnDemand() {
+  return window['go']['app']['App']['IsOnDemand']();
+}
+
+export function IsPaused() {
+  return window['go']['app']['App']['IsPaused']();
+}
+
+export function IsPausing() {
+  return window['go']['app']['App']['IsPausing']();
+}
+
+export function ListRemoteFolders(arg1) {
+  return window['go']['app']['App']['ListRemoteFolders'](arg1);
+}
+
+export function MakeAvailableOffline(arg1) {
+  return window['go']['app']['App']['MakeAvailableOffline'](arg1);
+}
+
 export function MinimizeToTray() {
   return window['go']['app']['App']['MinimizeToTray']();
 }
 
+export function PauseSync() {
+  return window['go']['app']['App']['PauseSync']();
+}
+
+export function RemoveLocalCopy(arg1) {
+  return window['go']['app']['App']['RemoveLocalCopy'](arg1);
+}
+
+export function RemoveWatchDir(arg1) {
+  return window['go']['app']['App']['RemoveWatchDir'](arg1);
+}
+
+export function Rescan() {
+  return window['go']['app']['App']['Rescan']();
+}
+
+export function ResolveConflict(arg1, arg2) {
+  return window['go']['app']['App']['ResolveConflict'](arg1, arg2);
+}
+
+export function RestoreDeletions() {
+  return window['go']['app']['App']['RestoreDeletions']();
+}
+
+export function ResumeSync() {
+  return window['go']['app']['App']['ResumeSync']();
+}
+
+export function SetBandwidthLimits(arg1) {
+  return window['go']['app']['App']['SetBandwidthLimits'](arg1);
+}
+
+export function SetBandwidthProfiles(arg1) {
+  return window['go']['app']['App']['SetBandwidthProfiles'](arg1);
+}
+
+export function SetFolderSelected(arg1, arg2) {
+  return window['go']['app']['App']['SetFolderSelected'](arg1, arg2);
+}
+
+export function SetOnDemand(arg1) {
+  return window['go']['app']['App']['SetOnDemand'](arg1);
+}
+
+export function SetSchedule(arg1) {
+  return window['go']['app']['App']['SetSchedule'](arg1);
+}
+
 export function SetWatchDir(arg1) {
   return window['go']['app']['App']['SetWatchDir'](arg1);
 }
@@ -33,3 +141,7 @@ export function SetupSystemTray() {
 export function Shutdown() {
   return window['go']['app']['App']['Shutdown']();
 }
+
+export function SyncNow() {
+  return window['go']['app']['App']['SyncNow']();
+}
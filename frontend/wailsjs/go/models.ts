@@ -1,5 +1,88 @@
 export namespace models {
 	
+	export class BandwidthLimits {
+	    upload: number;
+	    download: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BandwidthLimits(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.upload = source["upload"];
+	        this.download = source["download"];
+	    }
+	}
+	export class BandwidthProfile {
+	    windows: SyncWindow[];
+	    limits: BandwidthLimits;
+	
+	    static createFrom(source: any = {}) {
+	        return new BandwidthProfile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.windows = this.convertValues(source["windows"], SyncWindow);
+	        this.limits = this.convertValues(source["limits"], BandwidthLimits);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Conflict {
+	    path: string;
+	    copyPath: string;
+	    device: string;
+	    // Go type: time
+	    detectedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Conflict(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.copyPath = source["copyPath"];
+	        this.device = source["device"];
+	        this.detectedAt = this.convertValues(source["detectedAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class FileInfo {
 	    path: string;
 	    status: string;
@@ -13,6 +96,12 @@ export namespace models {
 	    // Go type: time
 	    lastSynced: any;
 	    filesContent?: Record<string, FileInfo>;
+	    error?: string;
+	    inode?: number;
+	    retries?: number;
+	    // Go type: time
+	    nextRetry: any;
+	    checksumAlgorithm?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new FileInfo(source);
@@ -30,6 +119,109 @@ export namespace models {
 	        this.checksum = source["checksum"];
 	        this.lastSynced = this.convertValues(source["lastSynced"], null);
 	        this.filesContent = this.convertValues(source["filesContent"], FileInfo, true);
+	        this.error = source["error"];
+	        this.inode = source["inode"];
+	        this.retries = source["retries"];
+	        this.nextRetry = this.convertValues(source["nextRetry"], null);
+	        this.checksumAlgorithm = source["checksumAlgorithm"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class IgnoreMatch {
+	    path: string;
+	    ignored: boolean;
+	    pattern?: string;
+	    source?: string;
+	    line?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new IgnoreMatch(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.ignored = source["ignored"];
+	        this.pattern = source["pattern"];
+	        this.source = source["source"];
+	        this.line = source["line"];
+	    }
+	}
+	export class RemoteFolder {
+	    path: string;
+	    name: string;
+	    selected: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RemoteFolder(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.name = source["name"];
+	        this.selected = source["selected"];
+	    }
+	}
+	export class SyncFolder {
+	    path: string;
+	    remotePath: string;
+	    running: boolean;
+	    paused: boolean;
+	    pausing: boolean;
+	    files: number;
+	    pending: number;
+	    errors: number;
+	    conflicts: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncFolder(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.remotePath = source["remotePath"];
+	        this.running = source["running"];
+	        this.paused = source["paused"];
+	        this.pausing = source["pausing"];
+	        this.files = source["files"];
+	        this.pending = source["pending"];
+	        this.errors = source["errors"];
+	        this.conflicts = source["conflicts"];
+	    }
+	}
+
+	export class SyncSchedule {
+	    upload?: SyncWindow[];
+	    download?: SyncWindow[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncSchedule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.upload = this.convertValues(source["upload"], SyncWindow);
+	        this.download = this.convertValues(source["download"], SyncWindow);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -50,6 +242,22 @@ export namespace models {
 		    return a;
 		}
 	}
+	export class SyncWindow {
+	    days?: string[];
+	    start?: string;
+	    end?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncWindow(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.days = source["days"];
+	        this.start = source["start"];
+	        this.end = source["end"];
+	    }
+	}
 
 }
 
@@ -2,30 +2,39 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	gopath "path"
 	"path/filepath"
+	"slices"
+	gosync "sync"
 	"time"
 
 	"homecloud/internal/config"
+	"homecloud/internal/hashing"
 	"homecloud/internal/models"
 	"homecloud/internal/server"
 	"homecloud/internal/storage"
 	"homecloud/internal/sync"
 
+	"github.com/getlantern/systray"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
 type App struct {
 	ctx           context.Context
-	syncManager   *sync.SyncManager
+	syncManagers  map[string]*sync.SyncManager
+	managersMu    gosync.RWMutex
 	configManager *config.Config
 	serverClient  *server.Client
 	metadataStore *storage.MetadataStore
 	appDataPath   string
 	iconData      []byte
 	isConnected   bool
+	trayPause     *systray.MenuItem
+	stopChan      chan struct{}
 }
 
 // NewApp creates a new App application struct
@@ -51,15 +60,21 @@ func NewApp(iconData []byte) *App {
 		cfg = config.DefaultConfig()
 	}
 
-	// Create a server client
+	// Create a server client, checksums are exchanged in the configured
+	// algorithm
 	client := server.NewClient(cfg.ServerURL)
+	if algorithm, err := hashing.ParseAlgorithm(cfg.HashAlgorithm); err == nil {
+		client.SetChecksumAlgorithm(algorithm)
+	}
 
 	return &App{
 		appDataPath:  appDataPath,
 		configManager: cfg,
 		serverClient: client,
+		syncManagers: make(map[string]*sync.SyncManager),
 		iconData:    iconData,
 		isConnected: false,
+		stopChan:    make(chan struct{}),
 	}
 }
 
@@ -76,11 +91,15 @@ func (a *App) Startup(ctx context.Context) {
 		a.metadataStore = metadataStore
 	}
 
-	// Initialize sync manager with default watch directory
-	a.syncManager = sync.NewSyncManager(a.configManager.WatchDirs[0])
-	err = a.syncManager.Start()
-	if err != nil {
-		fmt.Printf("failed to start sync manager: %v\n", err)
+	a.applyBandwidthLimits()
+	go a.bandwidthLoop()
+
+	// Start syncing every watch directory, one failing leaves the others
+	// running
+	for _, dir := range a.configManager.GetWatchDirs() {
+		if err := a.startSyncManager(dir); err != nil {
+			fmt.Printf("failed to start sync manager for %s: %v\n", dir, err)
+		}
 	}
 
 	// Try to load auth info and authenticate with the server
@@ -122,22 +141,28 @@ func (a *App) Connect(username, password string) error {
 	}
 
 	a.isConnected = true
+
+	// Files that failed on the old credentials need not wait for their
+	// next retry
+	for _, manager := range a.managers() {
+		manager.RetryNow()
+	}
 	return nil
 }
 
 // GetWatchDir returns the current watch directory
 func (a *App) GetWatchDir() string {
-	if len(a.configManager.WatchDirs) == 0 {
+	dirs := a.configManager.GetWatchDirs()
+	if len(dirs) == 0 {
 		return ""
 	}
-	return a.configManager.WatchDirs[0]
+	return dirs[0]
 }
 
-// SetWatchDir changes the watch directory and restarts the sync manager
+// SetWatchDir changes the first watch directory and restarts its sync
+// manager. It keeps syncing with the same remote folder.
 func (a *App) SetWatchDir(dir string) error {
-	if a.syncManager != nil {
-		a.syncManager.Stop()
-	}
+	dir = filepath.Clean(dir)
 
 	err := os.MkdirAll(dir, 0755)
 	if err != nil {
@@ -145,38 +170,477 @@ func (a *App) SetWatchDir(dir string) error {
 	}
 
 	// Update the first watch directory in config
-	if len(a.configManager.WatchDirs) == 0 {
-		a.configManager.WatchDirs = []string{dir}
-	} else {
-		a.configManager.WatchDirs[0] = dir
+	if old := a.configManager.SetWatchDir(dir); old != "" {
+		a.stopSyncManager(old)
 	}
 
 	// Save the updated configuration
-	configPath := filepath.Join(a.appDataPath, "config.json")
-	if err := config.SaveConfig(configPath, a.configManager); err != nil {
+	if err := a.saveConfig(); err != nil {
 		return err
 	}
 
-	a.syncManager = sync.NewSyncManager(dir)
-	return a.syncManager.Start()
+	return a.startSyncManager(dir)
 }
 
-// GetFiles returns the list of files being tracked
-func (a *App) GetFiles() []models.FileInfo {
-	if a.syncManager == nil {
-		return []models.FileInfo{}
+// AddWatchDir starts syncing another local directory with remotePath on the
+// server, an empty remotePath being the root of the server. The other watch
+// directories keep syncing meanwhile, without the part of the server the new
+// directory takes over from them.
+func (a *App) AddWatchDir(dir, remotePath string) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("watch directory must be an absolute path: %s", dir)
+	}
+	dir = filepath.Clean(dir)
+
+	if err := a.configManager.AddWatchDir(dir, remotePath); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		a.configManager.RemoveWatchDir(dir)
+		return fmt.Errorf("failed to create watch directory: %w", err)
+	}
+
+	if err := a.saveConfig(); err != nil {
+		return err
+	}
+
+	for _, manager := range a.managers() {
+		manager.SetExcludedFolders(a.configManager.GetExcludedFolders())
+	}
+
+	return a.startSyncManager(dir)
+}
+
+// RemoveWatchDir stops syncing a watch directory. Its files are left in
+// place, both locally and on the server. A watch directory it took over part
+// of the server from syncs that part again.
+func (a *App) RemoveWatchDir(dir string) error {
+	dir = filepath.Clean(dir)
+
+	dirs := a.configManager.GetWatchDirs()
+	index := slices.IndexFunc(dirs, func(existing string) bool {
+		return filepath.Clean(existing) == dir
+	})
+	if index < 0 {
+		return fmt.Errorf("%s is not a watch directory", dir)
+	}
+
+	a.stopSyncManager(dirs[index])
+
+	if err := a.configManager.RemoveWatchDir(dirs[index]); err != nil {
+		return err
+	}
+	if err := a.saveConfig(); err != nil {
+		return err
+	}
+
+	// The other watch directories take over the part of the server it synced
+	for _, manager := range a.managers() {
+		manager.SetExcludedFolders(a.configManager.GetExcludedFolders())
+	}
+	return nil
+}
+
+// GetSyncFolders returns the sync state of every watch directory
+func (a *App) GetSyncFolders() []models.SyncFolder {
+	folders := []models.SyncFolder{}
+	for _, manager := range a.managers() {
+		folders = append(folders, manager.Folder())
+	}
+	return folders
+}
+
+// ListRemoteFolders returns the folders inside the server folder path, an
+// empty path being the root of the server, and whether selective sync
+// mirrors them locally
+func (a *App) ListRemoteFolders(path string) ([]models.RemoteFolder, error) {
+	entries, err := a.serverClient.ListFiles(config.CleanRemotePath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	folders := []models.RemoteFolder{}
+	for _, entry := range entries {
+		if !entry.IsDirectory {
+			continue
+		}
+		folders = append(folders, models.RemoteFolder{
+			Path:     entry.Path,
+			Name:     gopath.Base(entry.Path),
+			Selected: !a.configManager.IsFolderExcluded(entry.Path),
+		})
+	}
+
+	return folders, nil
+}
+
+// SetFolderSelected ticks or unticks a server folder for selective sync.
+// Unticked folders are no longer downloaded, their local copy is kept until
+// RemoveLocalCopy is called.
+func (a *App) SetFolderSelected(path string, selected bool) error {
+	for _, manager := range a.managers() {
+		if manager.RemoteRoot() == config.CleanRemotePath(path) {
+			return fmt.Errorf("%s is synced by the watch directory %s, remove it instead", path, manager.WatchDir())
+		}
+	}
+
+	if err := a.configManager.SetFolderExcluded(path, !selected); err != nil {
+		return err
+	}
+	if err := a.saveConfig(); err != nil {
+		return err
+	}
+
+	for _, manager := range a.managers() {
+		manager.SetExcludedFolders(a.configManager.GetExcludedFolders())
+	}
+	return nil
+}
+
+// RemoveLocalCopy deletes the local copy of an unticked server folder,
+// provided everything in it is synced
+func (a *App) RemoveLocalCopy(path string) error {
+	path = config.CleanRemotePath(path)
+	for _, manager := range a.managers() {
+		if manager.ContainsRemote(path) {
+			return manager.RemoveLocalCopy(path)
+		}
 	}
+	return fmt.Errorf("/%s is not synced into a watch directory", path)
+}
 
-	fileInfos := a.syncManager.GetFileInfos()
+// MakeAvailableOffline downloads an online-only file, or every online-only
+// file of a folder
+func (a *App) MakeAvailableOffline(path string) error {
+	manager, path, err := a.managerFor(path)
+	if err != nil {
+		return err
+	}
+	return manager.MakeAvailableOffline(path)
+}
 
-	result := make([]models.FileInfo, len(fileInfos))
-	for i, info := range fileInfos {
-		result[i] = *info
+// FreeUpSpace deletes the local content of a synced file, or of the files
+// of a folder, keeping them online only. Files with unsynced changes are
+// kept.
+func (a *App) FreeUpSpace(path string) error {
+	manager, path, err := a.managerFor(path)
+	if err != nil {
+		return err
+	}
+	return manager.FreeUpSpace(path)
+}
+
+// IsOnDemand tells whether new remote files are left online only
+func (a *App) IsOnDemand() bool {
+	return a.configManager.IsOnDemand()
+}
+
+// SetOnDemand turns on-demand files on or off. Files already synced keep
+// their state.
+func (a *App) SetOnDemand(enabled bool) error {
+	a.configManager.SetOnDemand(enabled)
+	return a.saveConfig()
+}
+
+// PauseSync stops transfers in every watch directory. Running transfers
+// are cancelled and the app is pausing until they have stopped. Changes
+// keep being watched and are synced once resumed.
+func (a *App) PauseSync() {
+	for _, manager := range a.managers() {
+		manager.Pause()
+	}
+	a.updateTrayPause()
+}
+
+// ResumeSync starts transfers again after PauseSync
+func (a *App) ResumeSync() {
+	for _, manager := range a.managers() {
+		manager.Resume()
+	}
+	a.updateTrayPause()
+}
+
+// IsPaused reports whether transfers are paused
+func (a *App) IsPaused() bool {
+	for _, manager := range a.managers() {
+		if manager.IsPaused() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPausing reports whether transfers are paused but some of those that
+// were running have not stopped yet
+func (a *App) IsPausing() bool {
+	for _, manager := range a.managers() {
+		if manager.IsPausing() {
+			return true
+		}
+	}
+	return false
+}
+
+// onPaused tells the tray and the frontend that the transfers of a watch
+// directory have stopped after a pause
+func (a *App) onPaused() {
+	a.updateTrayPause()
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "sync:paused")
+	}
+}
+
+// GetSchedule returns the time windows transfers are limited to
+func (a *App) GetSchedule() models.SyncSchedule {
+	return a.configManager.GetSchedule()
+}
+
+// SetSchedule limits uploads and downloads to time windows. Transfers
+// waiting for a window start when it opens.
+func (a *App) SetSchedule(schedule models.SyncSchedule) error {
+	if err := a.configManager.SetSchedule(schedule); err != nil {
+		return err
+	}
+	return a.saveConfig()
+}
+
+// GetBandwidthLimits returns the default upload and download limits in
+// bytes per second
+func (a *App) GetBandwidthLimits() models.BandwidthLimits {
+	return a.configManager.GetBandwidthLimits()
+}
+
+// SetBandwidthLimits changes the default upload and download limits, zero
+// meaning unlimited. Transfers in progress follow the new limits.
+func (a *App) SetBandwidthLimits(limits models.BandwidthLimits) error {
+	if err := a.configManager.SetBandwidthLimits(limits); err != nil {
+		return err
+	}
+	a.applyBandwidthLimits()
+	return a.saveConfig()
+}
+
+// GetBandwidthProfiles returns the limits used during time windows instead
+// of the default ones
+func (a *App) GetBandwidthProfiles() []models.BandwidthProfile {
+	return a.configManager.GetBandwidthProfiles()
+}
+
+// SetBandwidthProfiles replaces the limits used during time windows
+func (a *App) SetBandwidthProfiles(profiles []models.BandwidthProfile) error {
+	if err := a.configManager.SetBandwidthProfiles(profiles); err != nil {
+		return err
+	}
+	a.applyBandwidthLimits()
+	return a.saveConfig()
+}
+
+// applyBandwidthLimits sets the limits in effect now on the server client
+func (a *App) applyBandwidthLimits() {
+	limits := a.configManager.ActiveBandwidthLimits(time.Now())
+	a.serverClient.SetBandwidthLimits(limits.Upload, limits.Download)
+}
+
+// bandwidthLoop switches the limits as bandwidth profiles start and end
+func (a *App) bandwidthLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopChan:
+			return
+		case <-ticker.C:
+			a.applyBandwidthLimits()
+		}
+	}
+}
+
+// saveConfig writes the configuration back to disk
+func (a *App) saveConfig() error {
+	configPath := filepath.Join(a.appDataPath, "config.json")
+	return config.SaveConfig(configPath, a.configManager)
+}
+
+// startSyncManager creates and starts the sync manager of a watch directory
+func (a *App) startSyncManager(dir string) error {
+	manager := sync.NewSyncManager(dir, a.serverClient, a.metadataStore, a.configManager)
+	manager.SetDeletionPrompt(a.promptDeletions)
+	manager.SetPausedHandler(a.onPaused)
+	if a.IsPaused() {
+		// Pausing applies to every watch directory
+		manager.Pause()
+	}
+
+	a.managersMu.Lock()
+	a.syncManagers[dir] = manager
+	a.managersMu.Unlock()
+
+	return manager.Start()
+}
+
+// stopSyncManager stops the sync manager of a watch directory, if running
+func (a *App) stopSyncManager(dir string) {
+	a.managersMu.Lock()
+	manager, exists := a.syncManagers[dir]
+	delete(a.syncManagers, dir)
+	a.managersMu.Unlock()
+
+	if exists {
+		manager.Stop()
+	}
+}
+
+// managers returns the sync managers in the order of the watch directories
+func (a *App) managers() []*sync.SyncManager {
+	a.managersMu.RLock()
+	defer a.managersMu.RUnlock()
+
+	managers := make([]*sync.SyncManager, 0, len(a.syncManagers))
+	for _, dir := range a.configManager.GetWatchDirs() {
+		if manager, exists := a.syncManagers[dir]; exists {
+			managers = append(managers, manager)
+		}
+	}
+	return managers
+}
+
+// managerFor returns the sync manager of the watch directory containing
+// path, along with path made absolute. A relative path is taken as relative
+// to the first watch directory.
+func (a *App) managerFor(path string) (*sync.SyncManager, string, error) {
+	managers := a.managers()
+	if len(managers) == 0 {
+		return nil, "", fmt.Errorf("sync is not running")
+	}
+
+	resolved := path
+	if !filepath.IsAbs(path) {
+		resolved = filepath.Join(managers[0].WatchDir(), path)
+	}
+	for _, manager := range managers {
+		if manager.Contains(resolved) {
+			return manager, resolved, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s is not inside a watch directory", path)
+}
+
+// promptDeletions brings the window up and tells the frontend that remote
+// deletions are waiting for confirmation
+func (a *App) promptDeletions(paths []string) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.WindowShow(a.ctx)
+	runtime.EventsEmit(a.ctx, "sync:deletions-held", paths)
+}
+
+// GetPendingDeletions returns the files whose deletion on the server is
+// held by the mass-delete safety brake
+func (a *App) GetPendingDeletions() []string {
+	paths := []string{}
+	for _, manager := range a.managers() {
+		paths = append(paths, manager.PendingDeletions()...)
+	}
+	return paths
+}
+
+// ConfirmDeletions deletes the held files from the server
+func (a *App) ConfirmDeletions() error {
+	managers := a.managers()
+	if len(managers) == 0 {
+		return fmt.Errorf("sync is not running")
+	}
+
+	var errs []error
+	for _, manager := range managers {
+		errs = append(errs, manager.ConfirmDeletions())
+	}
+	return errors.Join(errs...)
+}
+
+// RestoreDeletions cancels the held deletions and downloads the files again
+func (a *App) RestoreDeletions() error {
+	managers := a.managers()
+	if len(managers) == 0 {
+		return fmt.Errorf("sync is not running")
+	}
+
+	var errs []error
+	for _, manager := range managers {
+		errs = append(errs, manager.RestoreDeletions())
+	}
+	return errors.Join(errs...)
+}
+
+// GetFiles returns the list of files being tracked in every watch directory
+func (a *App) GetFiles() []models.FileInfo {
+	result := []models.FileInfo{}
+	for _, manager := range a.managers() {
+		for _, info := range manager.GetFileInfos() {
+			result = append(result, *info)
+		}
 	}
 
 	return result
 }
 
+// SyncNow checks the server for remote changes immediately instead of
+// waiting for the next sync interval
+func (a *App) SyncNow() {
+	for _, manager := range a.managers() {
+		manager.SyncNow()
+	}
+}
+
+// Rescan compares the watch directories with the stored sync state and
+// syncs whatever changed without the watcher noticing
+func (a *App) Rescan() {
+	for _, manager := range a.managers() {
+		manager.Rescan()
+	}
+}
+
+// GetConflicts returns the files that were changed both locally and
+// remotely and still need a decision from the user
+func (a *App) GetConflicts() ([]models.Conflict, error) {
+	result := []models.Conflict{}
+	for _, manager := range a.managers() {
+		conflicts, err := manager.GetConflicts()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, conflict := range conflicts {
+			result = append(result, *conflict)
+		}
+	}
+
+	return result, nil
+}
+
+// ResolveConflict settles the conflict of a conflicted copy. resolution is
+// one of KEEP_LOCAL, KEEP_REMOTE or KEEP_BOTH.
+func (a *App) ResolveConflict(copyPath string, resolution string) error {
+	manager, copyPath, err := a.managerFor(copyPath)
+	if err != nil {
+		return err
+	}
+	return manager.ResolveConflict(copyPath, models.ConflictResolution(resolution))
+}
+
+// ExplainIgnored tells whether a path is left out of the sync and which
+// ignore rule decided it
+func (a *App) ExplainIgnored(path string) (models.IgnoreMatch, error) {
+	manager, path, err := a.managerFor(path)
+	if err != nil {
+		return models.IgnoreMatch{}, err
+	}
+	return manager.ExplainIgnored(path), nil
+}
+
 // MinimizeToTray minimizes the application to system tray
 func (a *App) MinimizeToTray() {
 	// This will be called from the frontend to minimize to tray
@@ -192,11 +656,21 @@ func (a *App) IsConnected() bool {
 
 // Shutdown is called when the application is closing
 func (a *App) Shutdown() {
-	if a.metadataStore != nil {
-		a.metadataStore.Close()
+	close(a.stopChan)
+
+	// Stop syncing before the store goes away. Stop returns once a sync
+	// manager no longer uses the store, unfinished work stays queued in it
+	// for the next start.
+	a.managersMu.Lock()
+	managers := a.syncManagers
+	a.syncManagers = make(map[string]*sync.SyncManager)
+	a.managersMu.Unlock()
+
+	for _, manager := range managers {
+		manager.Stop()
 	}
 
-	if a.syncManager != nil {
-		a.syncManager.Stop()
+	if a.metadataStore != nil {
+		a.metadataStore.Close()
 	}
 }
\ No newline at end of file
@@ -22,6 +22,10 @@ func (a *App) onSystrayReady() {
 	systray.SetTooltip("Home Cloud - Your personal cloud")
 
 	mOpen := systray.AddMenuItem("Open HomeCloud", "Open HomeCloud")
+	mSync := systray.AddMenuItem("Sync now", "Check the server for changes")
+	mPause := systray.AddMenuItem("Pause syncing", "Stop transferring files")
+	a.trayPause = mPause
+	a.updateTrayPause()
 	systray.AddSeparator()
 	mQuit := systray.AddMenuItem("Exit", "Exit HomeCloud")
 
@@ -30,6 +34,14 @@ func (a *App) onSystrayReady() {
 			select {
 			case <-mOpen.ClickedCh:
 				runtime.WindowShow(a.ctx)
+			case <-mSync.ClickedCh:
+				a.SyncNow()
+			case <-mPause.ClickedCh:
+				if a.IsPaused() {
+					a.ResumeSync()
+				} else {
+					a.PauseSync()
+				}
 			case <-mQuit.ClickedCh:
 				runtime.Quit(a.ctx)
 				return
@@ -40,4 +52,27 @@ func (a *App) onSystrayReady() {
 
 func (a *App) onSystrayExit() {
 	runtime.WindowHide(a.ctx)
-}
\ No newline at end of file
+}
+
+// updateTrayPause labels the pause item of the tray menu after the current
+// state. It is disabled while pausing, until running transfers have stopped.
+func (a *App) updateTrayPause() {
+	if a.trayPause == nil {
+		return
+	}
+
+	switch {
+	case a.IsPausing():
+		a.trayPause.SetTitle("Pausing...")
+		a.trayPause.SetTooltip("Waiting for running transfers to stop")
+		a.trayPause.Disable()
+		return
+	case a.IsPaused():
+		a.trayPause.SetTitle("Resume syncing")
+		a.trayPause.SetTooltip("Start transferring files again")
+	default:
+		a.trayPause.SetTitle("Pause syncing")
+		a.trayPause.SetTooltip("Stop transferring files")
+	}
+	a.trayPause.Enable()
+}
@@ -0,0 +1,151 @@
+// Package chunking splits files into content-defined chunks with FastCDC.
+// Boundaries depend on the content around them rather than on offsets, so an
+// edit only changes the chunks it touches and the same data is cut into the
+// same chunks wherever it appears, in any file.
+package chunking
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"homecloud/internal/models"
+)
+
+// Bounds of the chunk size. Chunks average AvgSize, only the last chunk of a
+// file may be smaller than MinSize.
+const (
+	MinSize = 16 << 10
+	AvgSize = 64 << 10
+	MaxSize = 256 << 10
+)
+
+// The normalized chunking masks of FastCDC. Before AvgSize a boundary needs
+// more bits to match and past it fewer, which keeps chunk sizes close to the
+// average.
+const (
+	maskSmall = uint64(0xffffc) << 44 // 18 bits
+	maskLarge = uint64(0x3fff) << 50  // 14 bits
+)
+
+// gear maps every byte to a random value for the rolling gear hash. It is
+// derived from a fixed seed, every client must cut the same content the
+// same way for chunks to be shared.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x486f6d65436c6f75) // "HomeClou"
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		table[i] = z ^ z>>31
+	}
+	return table
+}()
+
+// cut returns the length of the chunk starting data, which holds either at
+// least MaxSize bytes or the rest of the content
+func cut(data []byte) int {
+	n := len(data)
+	if n <= MinSize {
+		return n
+	}
+	n = min(n, MaxSize)
+	normal := min(n, AvgSize)
+
+	var hash uint64
+	i := MinSize
+	for ; i < normal; i++ {
+		hash = hash<<1 + gear[data[i]]
+		if hash&maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = hash<<1 + gear[data[i]]
+		if hash&maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Chunker splits a stream into chunks
+type Chunker struct {
+	reader     io.Reader
+	buf        []byte
+	start, end int
+	eof        bool
+}
+
+// NewChunker creates a chunker reading from r
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{reader: r, buf: make([]byte, 2*MaxSize)}
+}
+
+// Next returns the data of the next chunk, valid until the following call,
+// or io.EOF once all content was returned
+func (c *Chunker) Next() ([]byte, error) {
+	if !c.eof && c.end-c.start < MaxSize {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+
+		for !c.eof && c.end < MaxSize {
+			n, err := c.reader.Read(c.buf[c.end:])
+			c.end += n
+			if err == io.EOF {
+				c.eof = true
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read content: %w", err)
+			}
+		}
+	}
+
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	n := cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// Hash returns the address of a chunk, the SHA-256 of its content
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Manifest splits the content read from r into chunks and returns them in
+// order
+func Manifest(r io.Reader) ([]models.Chunk, error) {
+	chunker := NewChunker(r)
+
+	var chunks []models.Chunk
+	for {
+		data, err := chunker.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, models.Chunk{Hash: Hash(data), Size: int64(len(data))})
+	}
+}
+
+// FileManifest returns the chunks of the file at path
+func FileManifest(path string) ([]models.Chunk, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return Manifest(file)
+}
@@ -0,0 +1,128 @@
+package chunking
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+	"testing/iotest"
+
+	"homecloud/internal/models"
+)
+
+// randomBytes returns n bytes of deterministic noise
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// manifest returns the chunks of data
+func manifest(t *testing.T, data []byte) []models.Chunk {
+	t.Helper()
+	chunks, err := Manifest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	return chunks
+}
+
+// hashes returns the set of chunk hashes of a manifest
+func hashes(chunks []models.Chunk) map[string]bool {
+	set := make(map[string]bool, len(chunks))
+	for _, chunk := range chunks {
+		set[chunk.Hash] = true
+	}
+	return set
+}
+
+func TestChunkSizes(t *testing.T) {
+	data := randomBytes(1, 8<<20)
+	chunks := manifest(t, data)
+
+	var total int64
+	for i, chunk := range chunks {
+		last := i == len(chunks)-1
+		if chunk.Size > MaxSize || (!last && chunk.Size < MinSize) {
+			t.Errorf("chunk %d is %d bytes, want between %d and %d", i, chunk.Size, MinSize, MaxSize)
+		}
+		if want := Hash(data[total : total+chunk.Size]); chunk.Hash != want {
+			t.Errorf("chunk %d has hash %s, want %s", i, chunk.Hash, want)
+		}
+		total += chunk.Size
+	}
+	if total != int64(len(data)) {
+		t.Fatalf("chunks cover %d bytes, want %d", total, len(data))
+	}
+
+	if average := total / int64(len(chunks)); average < AvgSize/2 || average > 2*AvgSize {
+		t.Errorf("chunks average %d bytes, want about %d", average, AvgSize)
+	}
+}
+
+func TestChunkSmallContent(t *testing.T) {
+	if chunks := manifest(t, nil); len(chunks) != 0 {
+		t.Errorf("empty content has %d chunks, want none", len(chunks))
+	}
+
+	data := []byte("smaller than a chunk")
+	chunks := manifest(t, data)
+	if len(chunks) != 1 || chunks[0].Size != int64(len(data)) {
+		t.Errorf("Manifest() = %v, want a single chunk of %d bytes", chunks, len(data))
+	}
+}
+
+func TestChunkBoundariesIgnoreReads(t *testing.T) {
+	data := randomBytes(2, 2<<20)
+	want := manifest(t, data)
+
+	got, err := Manifest(iotest.HalfReader(iotest.OneByteReader(bytes.NewReader(data))))
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("short reads cut %d chunks, want the same %d chunks as whole reads", len(got), len(want))
+	}
+}
+
+func TestChunkEditChangesFewChunks(t *testing.T) {
+	data := randomBytes(3, 8<<20)
+	original := hashes(manifest(t, data))
+
+	edited := slices.Concat(data[:4<<20], []byte("inserted in the middle"), data[4<<20:])
+	var changed int
+	for _, chunk := range manifest(t, edited) {
+		if !original[chunk.Hash] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 2 {
+		t.Errorf("an insertion changed %d chunks, want 1 or 2", changed)
+	}
+}
+
+func TestChunkDedup(t *testing.T) {
+	data := randomBytes(4, 2<<20)
+	single := hashes(manifest(t, data))
+
+	// Repeated content, even at an offset that is not a chunk boundary, is
+	// cut into the same chunks again once past the few chunks around where
+	// the copies meet
+	repeated := slices.Concat(data, []byte("shifted"), data)
+	var unknown int
+	for hash := range hashes(manifest(t, repeated)) {
+		if !single[hash] {
+			unknown++
+		}
+	}
+	if unknown > 3 {
+		t.Errorf("repeated content has %d chunks not in the original, want at most 3", unknown)
+	}
+}
+
+func TestHash(t *testing.T) {
+	const want = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := Hash(nil); got != want {
+		t.Errorf("Hash(nil) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// ValidateBandwidthProfiles reports the first profile that cannot be
+// understood
+func ValidateBandwidthProfiles(profiles []models.BandwidthProfile) error {
+	for i, profile := range profiles {
+		if len(profile.Windows) == 0 {
+			return fmt.Errorf("bandwidth profile %d has no time window", i+1)
+		}
+		if err := ValidateBandwidthLimits(profile.Limits); err != nil {
+			return err
+		}
+		if err := ValidateSchedule(models.SyncSchedule{Upload: profile.Windows}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateBandwidthLimits reports limits that are out of range
+func ValidateBandwidthLimits(limits models.BandwidthLimits) error {
+	if limits.Upload < 0 || limits.Download < 0 {
+		return fmt.Errorf("bandwidth limits cannot be negative")
+	}
+	return nil
+}
+
+// GetBandwidthLimits returns the default upload and download limits
+func (c *Config) GetBandwidthLimits() models.BandwidthLimits {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.BandwidthLimits
+}
+
+// SetBandwidthLimits changes the default upload and download limits
+func (c *Config) SetBandwidthLimits(limits models.BandwidthLimits) error {
+	if err := ValidateBandwidthLimits(limits); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BandwidthLimits = limits
+	return nil
+}
+
+// GetBandwidthProfiles returns the limits used during time windows instead
+// of the default ones
+func (c *Config) GetBandwidthProfiles() []models.BandwidthProfile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.BandwidthProfiles
+}
+
+// SetBandwidthProfiles replaces the limits used during time windows
+func (c *Config) SetBandwidthProfiles(profiles []models.BandwidthProfile) error {
+	if err := ValidateBandwidthProfiles(profiles); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BandwidthProfiles = profiles
+	return nil
+}
+
+// ActiveBandwidthLimits returns the limits in effect at t, those of the
+// first profile with a window open at t or the default ones
+func (c *Config) ActiveBandwidthLimits(t time.Time) models.BandwidthLimits {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, profile := range c.BandwidthProfiles {
+		if len(profile.Windows) > 0 && InSchedule(profile.Windows, t) {
+			return profile.Limits
+		}
+	}
+	return c.BandwidthLimits
+}
@@ -4,18 +4,65 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
+
+	"homecloud/internal/hashing"
+	"homecloud/internal/models"
 )
 
-// Config represents the application configuration
+// Config represents the application configuration. Once shared, the watch
+// directories and the settings that change while syncing are read and changed
+// through the methods of Config, which may be called concurrently.
 type Config struct {
+	mu sync.RWMutex
+
 	ServerURL      string        `json:"serverUrl"`
 	Username       string        `json:"username"`
 	Password       string        `json:"password,omitempty"` // Consider more secure storage
 	SyncFrequency  time.Duration `json:"syncFrequency"`
 	WatchDirs      []string      `json:"watchDirs"`
 	IgnorePatterns []string      `json:"ignorePatterns"`
+	// Remote deletions are held for confirmation when more than
+	// DeleteThresholdCount files, or more than DeleteThresholdPercent of the
+	// synced tree, disappear at once. Zero disables a limit.
+	DeleteThresholdCount   int     `json:"deleteThresholdCount"`
+	DeleteThresholdPercent float64 `json:"deleteThresholdPercent"`
+	// RescanInterval is how often the local tree is compared with the
+	// stored sync state, catching changes the watcher missed
+	RescanInterval time.Duration `json:"rescanInterval"`
+	// WatcherBackends selects how changes are detected per watch
+	// directory: "native" (the default) or "polling" for network mounts
+	// and other filesystems without change notifications
+	WatcherBackends map[string]string `json:"watcherBackends,omitempty"`
+	// PollInterval is how often the polling watcher scans its directory
+	PollInterval time.Duration `json:"pollInterval"`
+	// RemotePrefixes maps watch directories to the server directory they
+	// are synced with. Directories without an entry sync with the root of
+	// the server.
+	RemotePrefixes map[string]string `json:"remotePrefixes,omitempty"`
+	// ExcludedFolders are the server folders selective sync leaves out, they
+	// are neither downloaded nor scanned locally
+	ExcludedFolders []string `json:"excludedFolders,omitempty"`
+	// OnDemand leaves new remote files online only, they are listed but
+	// only downloaded once made available offline or inside a folder that
+	// is
+	OnDemand bool `json:"onDemand"`
+	// Schedule limits uploads and downloads to time windows, such as
+	// uploading only at night
+	Schedule models.SyncSchedule `json:"schedule"`
+	// BandwidthLimits caps uploads and downloads across all transfers
+	BandwidthLimits models.BandwidthLimits `json:"bandwidthLimits"`
+	// BandwidthProfiles replace BandwidthLimits during their time windows,
+	// the first one open wins
+	BandwidthProfiles []models.BandwidthProfile `json:"bandwidthProfiles,omitempty"`
+	// HashAlgorithm is what file checksums are computed with, "sha256" or
+	// "blake3". The server must support it.
+	HashAlgorithm string `json:"hashAlgorithm"`
 }
 
 // DefaultConfig returns a default configuration
@@ -34,7 +81,278 @@ func DefaultConfig() *Config {
 			"Thumbs.db",
 			"*.tmp",
 		},
+		DeleteThresholdCount:   50,
+		DeleteThresholdPercent: 30,
+		RescanInterval:         time.Hour,
+		PollInterval:           10 * time.Second,
+		HashAlgorithm:          string(hashing.DefaultAlgorithm),
+	}
+}
+
+// RemotePrefix returns the server directory watchDir is synced with, as a
+// slash-separated path without leading or trailing slashes
+func (c *Config) RemotePrefix(watchDir string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.remotePrefix(watchDir)
+}
+
+func (c *Config) remotePrefix(watchDir string) string {
+	return CleanRemotePath(c.RemotePrefixes[watchDir])
+}
+
+// WatcherBackend returns the watcher backend configured for watchDir, empty
+// for the default one
+func (c *Config) WatcherBackend(watchDir string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.WatcherBackends[watchDir]
+}
+
+// GetWatchDirs returns the watch directories
+func (c *Config) GetWatchDirs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.WatchDirs)
+}
+
+// SetWatchDir replaces the first watch directory with dir, which keeps its
+// settings, and returns the one replaced. dir becomes the only watch
+// directory if there were none.
+func (c *Config) SetWatchDir(dir string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.WatchDirs) == 0 {
+		c.WatchDirs = []string{dir}
+		return ""
+	}
+
+	old := c.WatchDirs[0]
+	c.WatchDirs = slices.Concat([]string{dir}, c.WatchDirs[1:])
+	c.renameFolderSettings(old, dir)
+	return old
+}
+
+// AddWatchDir adds dir, synced with remotePath on the server, an empty
+// remotePath being the root of the server. Where its server folder and one
+// already synced contain each other, the inner one is left out of the outer
+// one, which keeps syncing everything else.
+func (c *Config) AddWatchDir(dir, remotePath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Excluding folders builds a new slice, the old one is left as it was
+	excluded := c.ExcludedFolders
+	prefix := CleanRemotePath(remotePath)
+	for _, existing := range c.WatchDirs {
+		other := c.remotePrefix(existing)
+		if inner, nested := InnerRemoteFolder(prefix, other); nested && prefix != other {
+			if err := c.setFolderExcluded(inner, true); err != nil {
+				c.ExcludedFolders = excluded
+				return err
+			}
+		}
+	}
+
+	if err := c.checkWatchDir(dir, remotePath); err != nil {
+		c.ExcludedFolders = excluded
+		return err
+	}
+
+	c.WatchDirs = append(slices.Clone(c.WatchDirs), dir)
+	if remotePath != "" {
+		if c.RemotePrefixes == nil {
+			c.RemotePrefixes = make(map[string]string)
+		}
+		c.RemotePrefixes[dir] = remotePath
+	}
+	return nil
+}
+
+// RemoveWatchDir removes dir from the watch directories along with its
+// settings. The server folders AddWatchDir left out because dir and another
+// watch directory contain each other are synced again, unless still needed.
+func (c *Config) RemoveWatchDir(dir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	index := slices.IndexFunc(c.WatchDirs, func(existing string) bool {
+		return filepath.Clean(existing) == dir
+	})
+	if index < 0 {
+		return fmt.Errorf("%s is not a watch directory", dir)
+	}
+
+	removed := c.WatchDirs[index]
+	prefix := c.remotePrefix(removed)
+	c.WatchDirs = slices.Concat(c.WatchDirs[:index], c.WatchDirs[index+1:])
+	c.renameFolderSettings(removed, "")
+
+	for _, existing := range c.WatchDirs {
+		other := c.remotePrefix(existing)
+		if inner, nested := InnerRemoteFolder(prefix, other); nested && prefix != other && !c.nestedWatchDir(inner) {
+			c.ExcludedFolders = slices.DeleteFunc(slices.Clone(c.ExcludedFolders), func(folder string) bool {
+				return folder == inner
+			})
+		}
+	}
+	return nil
+}
+
+// nestedWatchDir reports whether the server folder remotePath is synced by a
+// watch directory of its own inside the server folder of another one
+func (c *Config) nestedWatchDir(remotePath string) bool {
+	var own, outer bool
+	for _, dir := range c.WatchDirs {
+		prefix := c.remotePrefix(dir)
+		if prefix == remotePath {
+			own = true
+		} else if inner, nested := InnerRemoteFolder(prefix, remotePath); nested && inner == remotePath {
+			outer = true
+		}
+	}
+	return own && outer
+}
+
+// renameFolderSettings moves the per-folder settings of a watch directory
+// to another one, or drops them if to is empty
+func (c *Config) renameFolderSettings(from, to string) {
+	for _, settings := range []map[string]string{c.RemotePrefixes, c.WatcherBackends} {
+		value, exists := settings[from]
+		if !exists {
+			continue
+		}
+		delete(settings, from)
+		if to != "" {
+			settings[to] = value
+		}
+	}
+}
+
+// CleanRemotePath normalizes a server path to a slash-separated path without
+// leading or trailing slashes, empty for the root of the server
+func CleanRemotePath(remotePath string) string {
+	cleaned := path.Clean("/" + strings.ReplaceAll(remotePath, "\\", "/"))
+	return strings.TrimPrefix(cleaned, "/")
+}
+
+// IsFolderExcluded reports whether selective sync leaves out the server
+// folder remotePath, itself or through one of its parents
+func (c *Config) IsFolderExcluded(remotePath string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isFolderExcluded(remotePath)
+}
+
+func (c *Config) isFolderExcluded(remotePath string) bool {
+	remotePath = CleanRemotePath(remotePath)
+	for _, excluded := range c.ExcludedFolders {
+		if excluded == remotePath || strings.HasPrefix(remotePath, excluded+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFolderExcluded adds the server folder remotePath to the folders
+// selective sync leaves out, or removes it. A folder inside an excluded one
+// cannot be included on its own.
+func (c *Config) SetFolderExcluded(remotePath string, excluded bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setFolderExcluded(remotePath, excluded)
+}
+
+func (c *Config) setFolderExcluded(remotePath string, excluded bool) error {
+	remotePath = CleanRemotePath(remotePath)
+	if remotePath == "" {
+		return fmt.Errorf("the root of the server cannot be excluded")
 	}
+
+	if parent := path.Dir(remotePath); parent != "." && c.isFolderExcluded(parent) {
+		if excluded {
+			return nil
+		}
+		return fmt.Errorf("%s is inside an excluded folder", remotePath)
+	}
+
+	// Folders inside remotePath follow it from now on
+	var kept []string
+	for _, folder := range c.ExcludedFolders {
+		if folder != remotePath && !strings.HasPrefix(folder, remotePath+"/") {
+			kept = append(kept, folder)
+		}
+	}
+	c.ExcludedFolders = kept
+
+	if excluded {
+		c.ExcludedFolders = append(c.ExcludedFolders, remotePath)
+	}
+	return nil
+}
+
+// GetExcludedFolders returns the server folders selective sync leaves out
+func (c *Config) GetExcludedFolders() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.ExcludedFolders)
+}
+
+// IsOnDemand tells whether new remote files are left online only
+func (c *Config) IsOnDemand() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.OnDemand
+}
+
+// SetOnDemand turns on-demand files on or off
+func (c *Config) SetOnDemand(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.OnDemand = enabled
+}
+
+// checkWatchDir reports whether dir can be synced with remotePrefix next to
+// the configured watch directories. Two folders must not contain each other
+// locally. On the server one may only contain the other when selective sync
+// leaves the inner one out, or they would sync the same files.
+func (c *Config) checkWatchDir(dir, remotePrefix string) error {
+	prefix := CleanRemotePath(remotePrefix)
+
+	for _, existing := range c.WatchDirs {
+		if nestedPaths(filepath.Clean(existing), filepath.Clean(dir), string(filepath.Separator)) {
+			return fmt.Errorf("%s overlaps with the watch directory %s", dir, existing)
+		}
+		other := c.remotePrefix(existing)
+		if inner, nested := InnerRemoteFolder(prefix, other); nested && (prefix == other || !c.isFolderExcluded(inner)) {
+			return fmt.Errorf("remote folder /%s overlaps with /%s synced by %s", prefix, other, existing)
+		}
+	}
+
+	return nil
+}
+
+// InnerRemoteFolder returns the inner one of two server folders when one
+// contains the other or they are the same
+func InnerRemoteFolder(a, b string) (string, bool) {
+	switch {
+	case a == b:
+		return a, true
+	case a == "" || strings.HasPrefix(b, a+"/"):
+		return b, true
+	case b == "" || strings.HasPrefix(a, b+"/"):
+		return a, true
+	}
+	return "", false
+}
+
+// nestedPaths reports whether a and b are the same path or one contains the
+// other
+func nestedPaths(a, b, separator string) bool {
+	return a == b || strings.HasPrefix(a, strings.TrimSuffix(b, separator)+separator) ||
+		strings.HasPrefix(b, strings.TrimSuffix(a, separator)+separator)
 }
 
 // LoadConfig loads configuration from the specified path
@@ -52,12 +370,13 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	// Settings missing from older files keep their default value
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 // SaveConfig saves the configuration to the specified path
@@ -68,7 +387,9 @@ func SaveConfig(path string, config *Config) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
+	config.mu.RLock()
 	data, err := json.MarshalIndent(config, "", "  ")
+	config.mu.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
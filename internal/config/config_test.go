@@ -0,0 +1,66 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWatchDirExclusions(t *testing.T) {
+	all, docs, photos := filepath.FromSlash("/all"), filepath.FromSlash("/docs"), filepath.FromSlash("/photos")
+
+	c := &Config{ExcludedFolders: []string{"music"}}
+	steps := []struct {
+		name   string
+		change func() error
+		want   []string
+	}{
+		{"outer", func() error { return c.AddWatchDir(all, "") }, []string{"music"}},
+		{"nested", func() error { return c.AddWatchDir(docs, "docs") }, []string{"music", "docs"}},
+		{"another nested", func() error { return c.AddWatchDir(photos, "/photos/") }, []string{"music", "docs", "photos"}},
+		{"nested removed", func() error { return c.RemoveWatchDir(docs) }, []string{"music", "photos"}},
+		{"nested added again", func() error { return c.AddWatchDir(docs, "docs") }, []string{"music", "photos", "docs"}},
+		{"outer removed", func() error { return c.RemoveWatchDir(all) }, []string{"music"}},
+	}
+
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		if got := c.GetExcludedFolders(); !slices.Equal(got, step.want) {
+			t.Fatalf("%s: excluded folders = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if got, want := c.GetWatchDirs(), []string{photos, docs}; !slices.Equal(got, want) {
+		t.Errorf("GetWatchDirs() = %q, want %q", got, want)
+	}
+	if _, exists := c.RemotePrefixes[all]; exists || c.RemotePrefix(docs) != "docs" {
+		t.Errorf("RemotePrefixes = %v, want those of the remaining watch directories", c.RemotePrefixes)
+	}
+}
+
+func TestAddWatchDirRejectsOverlaps(t *testing.T) {
+	c := &Config{}
+	if err := c.AddWatchDir(filepath.FromSlash("/all"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, dir, remotePath string
+	}{
+		{"same server folder", "/other", ""},
+		{"inside locally", "/all/sub", "sub"},
+		{"around locally", "/", "elsewhere"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := c.AddWatchDir(filepath.FromSlash(test.dir), test.remotePath); err == nil {
+				t.Errorf("AddWatchDir(%q, %q) succeeded", test.dir, test.remotePath)
+			}
+			if len(c.GetWatchDirs()) != 1 || len(c.GetExcludedFolders()) != 0 {
+				t.Errorf("a rejected watch directory left %q and exclusions %q", c.GetWatchDirs(), c.GetExcludedFolders())
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// weekdays maps the day names of sync windows to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ValidateSchedule reports the first window of schedule that cannot be
+// understood
+func ValidateSchedule(schedule models.SyncSchedule) error {
+	for _, windows := range [][]models.SyncWindow{schedule.Upload, schedule.Download} {
+		for _, window := range windows {
+			if _, _, err := parseWindow(window); err != nil {
+				return err
+			}
+			for _, day := range window.Days {
+				if _, ok := weekdays[strings.ToLower(day)]; !ok {
+					return fmt.Errorf("unknown day %q, expected one of mon, tue, wed, thu, fri, sat or sun", day)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// GetSchedule returns the time windows transfers are limited to
+func (c *Config) GetSchedule() models.SyncSchedule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Schedule
+}
+
+// SetSchedule limits transfers to the time windows of schedule
+func (c *Config) SetSchedule(schedule models.SyncSchedule) error {
+	if err := ValidateSchedule(schedule); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Schedule = schedule
+	return nil
+}
+
+// InSchedule reports whether t falls into one of windows. No windows means
+// no limit. Windows that cannot be understood never match.
+func InSchedule(windows []models.SyncWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	for _, window := range windows {
+		if windowContains(window, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowContains reports whether t falls into window
+func windowContains(window models.SyncWindow, t time.Time) bool {
+	start, end, err := parseWindow(window)
+	if err != nil {
+		return false
+	}
+
+	onDay := func(day time.Weekday) bool {
+		if len(window.Days) == 0 {
+			return true
+		}
+		for _, name := range window.Days {
+			if d, ok := weekdays[strings.ToLower(name)]; ok && d == day {
+				return true
+			}
+		}
+		return false
+	}
+
+	timeOfDay := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if start < end {
+		return onDay(t.Weekday()) && timeOfDay >= start && timeOfDay < end
+	}
+
+	// Past midnight, the part after it belongs to the day before
+	yesterday := (t.Weekday() + 6) % 7
+	return (onDay(t.Weekday()) && timeOfDay >= start) || (onDay(yesterday) && timeOfDay < end)
+}
+
+// parseWindow returns the start and end of window as offsets from midnight.
+// A missing start is midnight, a missing end the next midnight.
+func parseWindow(window models.SyncWindow) (time.Duration, time.Duration, error) {
+	start, err := parseTimeOfDay(window.Start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseTimeOfDay(window.End, 24*time.Hour)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		// As long as a day
+		return 0, 24 * time.Hour, nil
+	}
+	return start, end, nil
+}
+
+// parseTimeOfDay parses a "15:04" time of day, fallback is used when value
+// is empty
+func parseTimeOfDay(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// at returns the time of day clock on the weekday of the first week of 2024
+func at(day time.Weekday, clock string) time.Time {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		panic(err)
+	}
+	// January 7th 2024 was a Sunday
+	return time.Date(2024, 1, 7+int(day), t.Hour(), t.Minute(), 0, 0, time.Local)
+}
+
+func TestWindowContains(t *testing.T) {
+	daytime := models.SyncWindow{Start: "09:00", End: "17:00"}
+	weekdays := models.SyncWindow{Days: []string{"mon", "TUE"}, Start: "09:00", End: "17:00"}
+	night := models.SyncWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+	everyNight := models.SyncWindow{Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name   string
+		window models.SyncWindow
+		t      time.Time
+		want   bool
+	}{
+		{"inside", daytime, at(time.Wednesday, "12:00"), true},
+		{"at the start", daytime, at(time.Wednesday, "09:00"), true},
+		{"at the end", daytime, at(time.Wednesday, "17:00"), false},
+		{"before", daytime, at(time.Wednesday, "08:59"), false},
+		{"on one of the days", weekdays, at(time.Tuesday, "12:00"), true},
+		{"on another day", weekdays, at(time.Wednesday, "12:00"), false},
+
+		{"evening of the day", night, at(time.Friday, "23:00"), true},
+		{"morning after the day", night, at(time.Saturday, "05:59"), true},
+		{"end of the morning after", night, at(time.Saturday, "06:00"), false},
+		{"evening after the day", night, at(time.Saturday, "23:00"), false},
+		{"morning of the day", night, at(time.Friday, "05:00"), false},
+		{"afternoon of the day", night, at(time.Friday, "15:00"), false},
+		{"past midnight every day", everyNight, at(time.Monday, "03:00"), true},
+		{"before midnight every day", everyNight, at(time.Sunday, "22:30"), true},
+		{"daytime every day", everyNight, at(time.Monday, "12:00"), false},
+		{"past midnight into sunday", models.SyncWindow{Days: []string{"sat"}, Start: "23:00", End: "01:00"}, at(time.Sunday, "00:30"), true},
+
+		{"whole day", models.SyncWindow{Days: []string{"sun"}}, at(time.Sunday, "12:00"), true},
+		{"whole day on another day", models.SyncWindow{Days: []string{"sun"}}, at(time.Monday, "00:00"), false},
+		{"same start and end", models.SyncWindow{Start: "08:00", End: "08:00"}, at(time.Monday, "03:00"), true},
+		{"until midnight", models.SyncWindow{Start: "22:00"}, at(time.Monday, "23:59"), true},
+		{"from midnight", models.SyncWindow{End: "06:00"}, at(time.Monday, "00:00"), true},
+		{"invalid time", models.SyncWindow{Start: "25:00"}, at(time.Monday, "12:00"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := windowContains(test.window, test.t); got != test.want {
+				t.Errorf("windowContains(%+v, %s) = %v, want %v", test.window, test.t.Format("Mon 15:04"), got, test.want)
+			}
+		})
+	}
+}
+
+func TestInSchedule(t *testing.T) {
+	windows := []models.SyncWindow{
+		{Days: []string{"sat", "sun"}},
+		{Start: "22:00", End: "06:00"},
+	}
+
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(time.Saturday, "12:00"), true},
+		{at(time.Monday, "23:00"), true},
+		{at(time.Monday, "12:00"), false},
+	}
+	for _, test := range tests {
+		if got := InSchedule(windows, test.t); got != test.want {
+			t.Errorf("InSchedule() at %s = %v, want %v", test.t.Format("Mon 15:04"), got, test.want)
+		}
+	}
+
+	if !InSchedule(nil, at(time.Monday, "12:00")) {
+		t.Error("InSchedule() without windows = false, want true")
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		window models.SyncWindow
+		valid  bool
+	}{
+		{"valid", models.SyncWindow{Days: []string{"Mon", "fri"}, Start: "22:00", End: "06:00"}, true},
+		{"whole day", models.SyncWindow{}, true},
+		{"unknown day", models.SyncWindow{Days: []string{"monday"}}, false},
+		{"invalid start", models.SyncWindow{Start: "9am"}, false},
+		{"invalid end", models.SyncWindow{End: "24:00"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := models.SyncSchedule{Download: []models.SyncWindow{test.window}}
+			if err := ValidateSchedule(schedule); (err == nil) != test.valid {
+				t.Errorf("ValidateSchedule() error = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
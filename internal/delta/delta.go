@@ -0,0 +1,283 @@
+package delta
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Operations of a delta. A copy references a run of blocks of the old
+// version, a literal carries new data and the end marks a complete delta.
+const (
+	opCopy    = 'C'
+	opLiteral = 'L'
+	opEnd     = 'E'
+)
+
+// maxLiteral bounds the data carried by a single literal operation
+const maxLiteral = 64 << 10
+
+// deltaMagic starts every encoded delta
+var deltaMagic = [4]byte{'H', 'C', 'D', '1'}
+
+// Write computes the delta turning the version described by sig into the
+// content read from r and writes it to w. The content is streamed, only a
+// window of it is held in memory.
+func Write(w io.Writer, sig *Signature, r io.Reader) error {
+	bs := sig.BlockSize
+	enc := &encoder{writer: bufio.NewWriter(w)}
+	if err := enc.header(bs); err != nil {
+		return err
+	}
+
+	// Only full blocks can match while rolling, a short last block only
+	// matches the end of the content
+	index := make(map[uint32][]int, len(sig.Blocks))
+	var tail *Block
+	for i, block := range sig.Blocks {
+		if block.Size == bs {
+			index[block.Weak] = append(index[block.Weak], i)
+		} else {
+			tail = &sig.Blocks[i]
+		}
+	}
+
+	// buf[litStart:start] is literal data not sent yet and buf[start:] the
+	// window being matched followed by content read ahead
+	buf := make([]byte, 0, maxLiteral+4*bs)
+	start, litStart := 0, 0
+	eof := false
+
+	fill := func(need int) error {
+		for !eof && len(buf)-start < need {
+			if len(buf) == cap(buf) {
+				if litStart == 0 {
+					if err := enc.literal(buf[:start]); err != nil {
+						return err
+					}
+					litStart = start
+				}
+				n := copy(buf, buf[litStart:])
+				buf = buf[:n]
+				start -= litStart
+				litStart = 0
+			}
+
+			n, err := r.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return fmt.Errorf("failed to read content: %w", err)
+			}
+		}
+		return nil
+	}
+
+	var sum rollingSum
+	rolling := false
+	for {
+		if err := fill(bs); err != nil {
+			return err
+		}
+		if len(buf)-start < bs {
+			break
+		}
+
+		if !rolling {
+			sum = newRollingSum(buf[start : start+bs])
+			rolling = true
+		}
+		if block, ok := enc.match(sig, index[sum.sum()], buf[start:start+bs]); ok {
+			if err := enc.literal(buf[litStart:start]); err != nil {
+				return err
+			}
+			enc.copy(block)
+			start += bs
+			litStart = start
+			rolling = false
+			continue
+		}
+
+		// Slide the window by one byte, the byte leaving it becomes literal
+		if err := fill(bs + 1); err != nil {
+			return err
+		}
+		if len(buf)-start <= bs {
+			break
+		}
+		sum.roll(buf[start], buf[start+bs])
+		start++
+		if start-litStart >= maxLiteral {
+			if err := enc.literal(buf[litStart:start]); err != nil {
+				return err
+			}
+			litStart = start
+		}
+	}
+
+	// What is left did not match a full block, unless it ends with the
+	// short last block everything goes as literal data
+	rest := buf[litStart:]
+	if tail != nil && len(rest) >= tail.Size {
+		end := rest[len(rest)-tail.Size:]
+		if newRollingSum(end).sum() == tail.Weak && strongSum(end) == tail.Strong {
+			if err := enc.literal(rest[:len(rest)-tail.Size]); err != nil {
+				return err
+			}
+			enc.copy(len(sig.Blocks) - 1)
+			rest = nil
+		}
+	}
+	if err := enc.literal(rest); err != nil {
+		return err
+	}
+
+	return enc.end()
+}
+
+// encoder writes delta operations, merging copies of consecutive blocks
+type encoder struct {
+	writer *bufio.Writer
+	// copyStart and copyCount are the run of blocks waiting to be written
+	copyStart int
+	copyCount int
+}
+
+func (e *encoder) header(blockSize int) error {
+	header := binary.BigEndian.AppendUint32(deltaMagic[:], uint32(blockSize))
+	_, err := e.writer.Write(header)
+	return err
+}
+
+// match returns the block among candidates with the same strong checksum as
+// data. The block following the last copied one is preferred so runs of
+// blocks stay together.
+func (e *encoder) match(sig *Signature, candidates []int, data []byte) (int, bool) {
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	strong := strongSum(data)
+	next := e.copyStart + e.copyCount
+	if e.copyCount > 0 && next < len(sig.Blocks) && sig.Blocks[next].Strong == strong {
+		for _, i := range candidates {
+			if i == next {
+				return next, true
+			}
+		}
+	}
+	for _, i := range candidates {
+		if sig.Blocks[i].Strong == strong {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (e *encoder) copy(block int) {
+	if e.copyCount > 0 && block == e.copyStart+e.copyCount {
+		e.copyCount++
+		return
+	}
+	e.flushCopy()
+	e.copyStart, e.copyCount = block, 1
+}
+
+func (e *encoder) flushCopy() {
+	if e.copyCount == 0 {
+		return
+	}
+	op := []byte{opCopy}
+	op = binary.BigEndian.AppendUint32(op, uint32(e.copyStart))
+	op = binary.BigEndian.AppendUint32(op, uint32(e.copyCount))
+	// Errors stick to the writer and surface on the next write or flush
+	e.writer.Write(op)
+	e.copyCount = 0
+}
+
+func (e *encoder) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	e.flushCopy()
+
+	for len(data) > 0 {
+		n := min(len(data), maxLiteral)
+		op := binary.BigEndian.AppendUint32([]byte{opLiteral}, uint32(n))
+		if _, err := e.writer.Write(op); err != nil {
+			return err
+		}
+		if _, err := e.writer.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (e *encoder) end() error {
+	e.flushCopy()
+	if err := e.writer.WriteByte(opEnd); err != nil {
+		return err
+	}
+	return e.writer.Flush()
+}
+
+// Apply rebuilds the new version of a file from the delta read from r and
+// writes it to w. base is the old version the delta's signature was
+// computed from.
+func Apply(w io.Writer, base io.ReaderAt, r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("failed to read delta: %w", err)
+	}
+	if [4]byte(header[:4]) != deltaMagic {
+		return errors.New("not a delta")
+	}
+	blockSize := int64(binary.BigEndian.Uint32(header[4:]))
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	args := make([]byte, 8)
+	for {
+		op, err := br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("failed to read delta: %w", err)
+		}
+
+		switch op {
+		case opCopy:
+			if _, err := io.ReadFull(br, args); err != nil {
+				return fmt.Errorf("failed to read delta: %w", err)
+			}
+			start := int64(binary.BigEndian.Uint32(args)) * blockSize
+			length := int64(binary.BigEndian.Uint32(args[4:])) * blockSize
+			// The last block may be short, the copy then stops at the end
+			// of the old version
+			if _, err := io.Copy(w, io.NewSectionReader(base, start, length)); err != nil {
+				return fmt.Errorf("failed to copy blocks: %w", err)
+			}
+		case opLiteral:
+			if _, err := io.ReadFull(br, args[:4]); err != nil {
+				return fmt.Errorf("failed to read delta: %w", err)
+			}
+			length := int64(binary.BigEndian.Uint32(args))
+			if length > maxLiteral {
+				return fmt.Errorf("literal of %d bytes exceeds the limit", length)
+			}
+			if _, err := io.CopyN(w, br, length); err != nil {
+				return fmt.Errorf("failed to copy literal data: %w", err)
+			}
+		case opEnd:
+			return nil
+		default:
+			return fmt.Errorf("unknown delta operation %q", op)
+		}
+	}
+}
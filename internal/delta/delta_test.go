@@ -0,0 +1,125 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomBytes returns n bytes of deterministic noise
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// roundTrip computes the delta turning base into target, passing the
+// signature through its encoding, and returns the delta and the version
+// rebuilt from it
+func roundTrip(t *testing.T, base, target []byte, blockSize int) (delta, rebuilt []byte) {
+	t.Helper()
+
+	sig, err := NewSignature(bytes.NewReader(base), blockSize)
+	if err != nil {
+		t.Fatalf("NewSignature() error = %v", err)
+	}
+	var encoded bytes.Buffer
+	if _, err := sig.WriteTo(&encoded); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if sig, err = ReadSignature(&encoded); err != nil {
+		t.Fatalf("ReadSignature() error = %v", err)
+	}
+
+	var d bytes.Buffer
+	if err := Write(&d, sig, bytes.NewReader(target)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := Apply(&out, bytes.NewReader(base), bytes.NewReader(d.Bytes())); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	return d.Bytes(), out.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	const size = 200 << 10
+	base := randomBytes(1, size)
+	edited := slices.Clone(base)
+	copy(edited[100<<10:], "an edit in the middle")
+
+	tests := []struct {
+		name   string
+		base   []byte
+		target []byte
+		// maxDelta bounds the size of the delta, zero for no bound
+		maxDelta int
+	}{
+		{"identical", base, base, 1 << 10},
+		{"edit in the middle", base, edited, 8 << 10},
+		{"insertion at the start", base, append([]byte("inserted"), base...), 8 << 10},
+		{"appended", base, append(slices.Clone(base), "appended"...), 8 << 10},
+		{"truncated", base, base[:size-3000], 8 << 10},
+		{"blocks reordered", base, append(slices.Clone(base[size/2:]), base[:size/2]...), 8 << 10},
+		{"unrelated", base, randomBytes(2, size), 0},
+		{"empty base", nil, base, 0},
+		{"empty target", base, nil, 1 << 10},
+		{"shorter than a block", []byte("short"), []byte("shorter"), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, rebuilt := roundTrip(t, test.base, test.target, MinBlockSize)
+			if !bytes.Equal(rebuilt, test.target) {
+				t.Fatalf("rebuilt %d bytes, want the %d bytes of the target", len(rebuilt), len(test.target))
+			}
+			if test.maxDelta > 0 && len(d) > test.maxDelta {
+				t.Errorf("delta is %d bytes, want at most %d", len(d), test.maxDelta)
+			}
+		})
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want int
+	}{
+		{0, MinBlockSize},
+		{1 << 20, MinBlockSize},
+		{100 << 20, 10 << 10},
+		// Rounded up to whole kilobytes
+		{101 << 20, 11 << 10},
+		{1 << 40, MaxBlockSize},
+	}
+
+	for _, test := range tests {
+		if got := BlockSize(test.size); got != test.want {
+			t.Errorf("BlockSize(%d) = %d, want %d", test.size, got, test.want)
+		}
+	}
+}
+
+func TestRollingSum(t *testing.T) {
+	data := randomBytes(3, 4096)
+	const window = 512
+
+	r := newRollingSum(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		r.roll(data[i-1], data[i+window-1])
+		if want := newRollingSum(data[i : i+window]).sum(); r.sum() != want {
+			t.Fatalf("rolled sum at %d = %#x, want %#x", i, r.sum(), want)
+		}
+	}
+}
+
+func TestReadSignatureRejectsGarbage(t *testing.T) {
+	if _, err := ReadSignature(bytes.NewReader([]byte("not a signature"))); err == nil {
+		t.Error("ReadSignature() accepted data without the signature magic")
+	}
+	if err := Apply(&bytes.Buffer{}, bytes.NewReader(nil), bytes.NewReader([]byte("not a delta"))); err == nil {
+		t.Error("Apply() accepted data without the delta magic")
+	}
+}
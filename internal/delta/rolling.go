@@ -0,0 +1,30 @@
+package delta
+
+// rollingSum is the weak checksum of rsync, derived from Adler-32. It can be
+// moved along the data one byte at a time without reading the whole window
+// again.
+type rollingSum struct {
+	a, b uint32
+	n    uint32
+}
+
+// newRollingSum computes the checksum of window
+func newRollingSum(window []byte) rollingSum {
+	r := rollingSum{n: uint32(len(window))}
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += uint32(len(window)-i) * uint32(c)
+	}
+	return r
+}
+
+// roll moves the window one byte ahead, out leaving it and in entering it
+func (r *rollingSum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+// sum returns the checksum of the current window
+func (r rollingSum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
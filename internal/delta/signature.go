@@ -0,0 +1,175 @@
+// Package delta implements rsync-style delta transfers. The side holding
+// the old version of a file describes it with a Signature, a weak rolling
+// checksum and a strong checksum per block. The side holding the new version
+// finds those blocks in it with the rolling checksum and sends references to
+// them along with the data in between, which the other side applies to its
+// old version to rebuild the new one.
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// MinBlockSize and MaxBlockSize bound the block size of signatures
+	MinBlockSize = 2 << 10
+	MaxBlockSize = 64 << 10
+
+	// strongSize is the number of bytes kept of a block's strong checksum,
+	// the checksum of the rebuilt file catches the rare false match
+	strongSize = 16
+
+	// maxBlocks bounds the signatures read from the network
+	maxBlocks = 1 << 24
+)
+
+// signatureMagic starts every encoded signature
+var signatureMagic = [4]byte{'H', 'C', 'S', '1'}
+
+// Signature describes a version of a file block by block. The last block
+// may be shorter than the others.
+type Signature struct {
+	BlockSize int
+	Blocks    []Block
+}
+
+// Block holds the checksums of a block
+type Block struct {
+	Weak   uint32
+	Strong [strongSize]byte
+	// Size is the length of the block, BlockSize for all but the last one
+	Size int
+}
+
+// BlockSize picks the block size for a file of size bytes, the square root
+// of the size as rsync does, so both the signature and the delta stay small
+func BlockSize(size int64) int {
+	blockSize := int(math.Sqrt(float64(size)))
+	// Rounded up to whole kilobytes
+	blockSize = (blockSize + 1023) &^ 1023
+	return min(max(blockSize, MinBlockSize), MaxBlockSize)
+}
+
+// NewSignature computes the signature of the content read from r
+func NewSignature(r io.Reader, blockSize int) (*Signature, error) {
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	sig := &Signature{BlockSize: blockSize}
+	block := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			sig.Blocks = append(sig.Blocks, Block{
+				Weak:   newRollingSum(block[:n]).sum(),
+				Strong: strongSum(block[:n]),
+				Size:   n,
+			})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+}
+
+// strongSum is the strong checksum of a block
+func strongSum(block []byte) [strongSize]byte {
+	sum := sha256.Sum256(block)
+	return [strongSize]byte(sum[:strongSize])
+}
+
+// WriteTo encodes the signature to w
+func (s *Signature) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	counter := &countingWriter{writer: bw}
+
+	header := make([]byte, 0, 16)
+	header = append(header, signatureMagic[:]...)
+	header = binary.BigEndian.AppendUint32(header, uint32(s.BlockSize))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(s.Blocks)))
+	if len(s.Blocks) > 0 {
+		header = binary.BigEndian.AppendUint32(header, uint32(s.Blocks[len(s.Blocks)-1].Size))
+	}
+	if _, err := counter.Write(header); err != nil {
+		return counter.n, err
+	}
+
+	entry := make([]byte, 4+strongSize)
+	for _, block := range s.Blocks {
+		binary.BigEndian.PutUint32(entry, block.Weak)
+		copy(entry[4:], block.Strong[:])
+		if _, err := counter.Write(entry); err != nil {
+			return counter.n, err
+		}
+	}
+
+	return counter.n, bw.Flush()
+}
+
+// ReadSignature decodes a signature written by WriteTo
+func ReadSignature(r io.Reader) (*Signature, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	if [4]byte(header[:4]) != signatureMagic {
+		return nil, errors.New("not a signature")
+	}
+
+	sig := &Signature{BlockSize: int(binary.BigEndian.Uint32(header[4:8]))}
+	count := binary.BigEndian.Uint32(header[8:12])
+	if sig.BlockSize < MinBlockSize || sig.BlockSize > MaxBlockSize || count > maxBlocks {
+		return nil, fmt.Errorf("invalid signature of %d blocks of %d bytes", count, sig.BlockSize)
+	}
+	if count == 0 {
+		return sig, nil
+	}
+
+	var lastSize uint32
+	if err := binary.Read(br, binary.BigEndian, &lastSize); err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	if lastSize == 0 || lastSize > uint32(sig.BlockSize) {
+		return nil, fmt.Errorf("invalid last block size %d", lastSize)
+	}
+
+	sig.Blocks = make([]Block, count)
+	entry := make([]byte, 4+strongSize)
+	for i := range sig.Blocks {
+		if _, err := io.ReadFull(br, entry); err != nil {
+			return nil, fmt.Errorf("failed to read signature: %w", err)
+		}
+		sig.Blocks[i] = Block{
+			Weak:   binary.BigEndian.Uint32(entry),
+			Strong: [strongSize]byte(entry[4:]),
+			Size:   sig.BlockSize,
+		}
+	}
+	sig.Blocks[count-1].Size = int(lastSize)
+
+	return sig, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,201 @@
+// internal/filesystem/debouncer.go
+package filesystem
+
+import (
+	"cmp"
+	"os"
+	"slices"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// DefaultQuietPeriod is how long a path must see no events before its
+// coalesced event is emitted
+const DefaultQuietPeriod = 500 * time.Millisecond
+
+// Debouncer merges bursts of file events per path. Saving a file often
+// takes several writes, temp files and renames; the debouncer turns them
+// into a single event once the path has been quiet for the quiet period and
+// the file stopped changing.
+type Debouncer struct {
+	in       chan models.FileEvent
+	out      chan<- models.FileEvent
+	quiet    time.Duration
+	pending  map[string]*pendingEvent
+	seq      uint64
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// pendingEvent is the coalesced event of a path waiting to settle
+type pendingEvent struct {
+	event models.FileEvent
+	seq   uint64
+	due   time.Time
+	size  int64
+	mtime time.Time
+}
+
+// NewDebouncer creates a debouncer that emits coalesced events on out.
+// Events are fed through the channel returned by Events.
+func NewDebouncer(out chan<- models.FileEvent, quiet time.Duration) *Debouncer {
+	return &Debouncer{
+		in:       make(chan models.FileEvent),
+		out:      out,
+		quiet:    quiet,
+		pending:  make(map[string]*pendingEvent),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Events returns the channel the raw events are sent to
+func (d *Debouncer) Events() chan models.FileEvent {
+	return d.in
+}
+
+// Start begins coalescing events
+func (d *Debouncer) Start() {
+	go d.run()
+}
+
+// Stop stops the debouncer and waits for it to exit. Events still waiting
+// to settle are dropped, the sync manager rescans the tree on start.
+func (d *Debouncer) Stop() {
+	close(d.stopChan)
+	<-d.done
+}
+
+// run processes incoming events and emits the settled ones
+func (d *Debouncer) run() {
+	defer close(d.done)
+
+	timer := time.NewTimer(d.quiet)
+	timer.Stop()
+
+	for {
+		select {
+		case <-d.stopChan:
+			timer.Stop()
+			return
+		case event := <-d.in:
+			d.add(event)
+		case <-timer.C:
+			if !d.flush() {
+				return
+			}
+		}
+
+		timer.Stop()
+		if next, ok := d.nextDue(); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// add merges an event into the pending event of its path
+func (d *Debouncer) add(event models.FileEvent) {
+	d.seq++
+
+	p, exists := d.pending[event.Path]
+	if !exists {
+		p = &pendingEvent{event: event, seq: d.seq}
+		d.pending[event.Path] = p
+	} else {
+		merged, keep := coalesce(p.event.Type, event.Type)
+		if !keep {
+			delete(d.pending, event.Path)
+			return
+		}
+		p.event.Type = merged
+		p.event.Timestamp = event.Timestamp
+	}
+
+	p.due = time.Now().Add(d.quiet)
+	p.size, p.mtime = statFile(event.Path)
+}
+
+// coalesce merges the pending event type of a path with the type of a newer
+// event. It returns false when the two cancel out, such as a temp file
+// created and removed within the quiet period.
+func coalesce(pending, next models.FileEventType) (models.FileEventType, bool) {
+	switch {
+	case pending == models.EventCreated:
+		if next == models.EventDeleted || next == models.EventRenamed {
+			return "", false
+		}
+		// Still a new file, however often it was written
+		return models.EventCreated, true
+	case next == models.EventCreated:
+		// Replaced, or deleted and recreated, as editors do on save
+		return models.EventModified, true
+	case pending == models.EventDeleted && next == models.EventRenamed:
+		return models.EventDeleted, true
+	default:
+		return next, true
+	}
+}
+
+// flush emits the pending events that are due, in the order they were
+// first seen so a directory comes before its content and a rename before
+// the creation of its new name. It returns false if the debouncer was
+// stopped meanwhile.
+func (d *Debouncer) flush() bool {
+	now := time.Now()
+
+	var due []*pendingEvent
+	for path, p := range d.pending {
+		if p.due.After(now) {
+			continue
+		}
+
+		if p.event.Type != models.EventDeleted && p.event.Type != models.EventRenamed {
+			// Writes without events, as some copies do, still have to finish
+			size, mtime := statFile(path)
+			if size != p.size || !mtime.Equal(p.mtime) {
+				p.size, p.mtime = size, mtime
+				p.due = now.Add(d.quiet)
+				continue
+			}
+		}
+
+		due = append(due, p)
+		delete(d.pending, path)
+	}
+
+	slices.SortFunc(due, func(a, b *pendingEvent) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	for _, p := range due {
+		select {
+		case d.out <- p.event:
+		case <-d.stopChan:
+			return false
+		}
+	}
+
+	return true
+}
+
+// nextDue returns when the next pending event is due
+func (d *Debouncer) nextDue() (time.Time, bool) {
+	var next time.Time
+	for _, p := range d.pending {
+		if next.IsZero() || p.due.Before(next) {
+			next = p.due
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// statFile returns the size and modification time of a file, or zero values
+// if it does not exist
+func statFile(path string) (int64, time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, time.Time{}
+	}
+	return info.Size(), info.ModTime()
+}
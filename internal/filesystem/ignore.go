@@ -0,0 +1,277 @@
+// internal/filesystem/ignore.go
+package filesystem
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"homecloud/internal/models"
+)
+
+// IgnoreFileName is the name of the per-directory ignore files
+const IgnoreFileName = ".homecloudignore"
+
+// ConfigIgnoreSource is the source reported for the global patterns
+const ConfigIgnoreSource = "config"
+
+// ExcludedSource is the source reported for folders left out by selective
+// sync
+const ExcludedSource = "selective sync"
+
+// IgnoreRules decides which paths are left out of the sync. Rules use the
+// gitignore syntax and come from the global patterns of the config and from
+// the .homecloudignore files of the tree. Like in git, later rules win over
+// earlier ones, rules of deeper directories win over those of their parents,
+// and the global patterns have the lowest priority. Nothing inside an
+// ignored directory can be re-included. On top of the rules, folders can be
+// excluded by path, they win over every rule.
+type IgnoreRules struct {
+	root     string
+	global   []ignoreRule
+	mu       sync.Mutex
+	files    map[string][]ignoreRule
+	excluded map[string]bool
+}
+
+// ignoreRule is a single parsed pattern
+type ignoreRule struct {
+	pattern  string
+	source   string
+	line     int
+	segments []string
+	negated  bool
+	dirOnly  bool
+}
+
+// NewIgnoreRules creates the ignore rules of the tree at root with the
+// given global patterns
+func NewIgnoreRules(root string, patterns []string) *IgnoreRules {
+	r := &IgnoreRules{
+		root:  root,
+		files: make(map[string][]ignoreRule),
+	}
+	for i, pattern := range patterns {
+		if rule, ok := parseIgnoreRule(pattern, ConfigIgnoreSource, i+1); ok {
+			r.global = append(r.global, rule)
+		}
+	}
+	return r
+}
+
+// IsIgnored reports whether path is left out of the sync
+func (r *IgnoreRules) IsIgnored(path string, isDir bool) bool {
+	return r.Match(path, isDir).Ignored
+}
+
+// Match explains whether path is ignored and which rule decided it
+func (r *IgnoreRules) Match(path string, isDir bool) models.IgnoreMatch {
+	match := models.IgnoreMatch{Path: path}
+
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return match
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+
+	// A path inside an ignored directory is ignored whatever its own rules
+	for i := 1; i <= len(segments); i++ {
+		if dir := strings.Join(segments[:i], "/"); r.isExcluded(dir) {
+			match.Ignored = true
+			match.Pattern, match.Source, match.Line = dir, ExcludedSource, 0
+			return match
+		}
+
+		rule := r.decide(segments[:i], i < len(segments) || isDir)
+		if rule == nil || rule.negated {
+			if i == len(segments) && rule != nil {
+				match.Pattern, match.Source, match.Line = rule.pattern, rule.source, rule.line
+			}
+			continue
+		}
+
+		match.Ignored = true
+		match.Pattern, match.Source, match.Line = rule.pattern, rule.source, rule.line
+		return match
+	}
+
+	return match
+}
+
+// SetExcluded replaces the excluded folders, given as slash-separated paths
+// relative to the root
+func (r *IgnoreRules) SetExcluded(dirs []string) {
+	excluded := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		excluded[path.Clean(dir)] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.excluded = excluded
+}
+
+// isExcluded reports whether the slash-separated path dir is an excluded
+// folder
+func (r *IgnoreRules) isExcluded(dir string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.excluded[dir]
+}
+
+// Invalidate forgets the cached rules of the ignore file at path, it is
+// read again on the next lookup
+func (r *IgnoreRules) Invalidate(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.files, filepath.Dir(path))
+}
+
+// IsIgnoreFile reports whether path is a per-directory ignore file
+func IsIgnoreFile(path string) bool {
+	return filepath.Base(path) == IgnoreFileName
+}
+
+// decide returns the last rule matching the path made of segments, or nil
+func (r *IgnoreRules) decide(segments []string, isDir bool) *ignoreRule {
+	var decided *ignoreRule
+
+	check := func(rules []ignoreRule, segments []string) {
+		for i := range rules {
+			if rules[i].matches(segments, isDir) {
+				decided = &rules[i]
+			}
+		}
+	}
+
+	check(r.global, segments)
+
+	// The ignore files of every directory above the path, from the root
+	// down. Their patterns are relative to their own directory.
+	dir := r.root
+	for i := 0; i < len(segments); i++ {
+		check(r.fileRules(dir), segments[i:])
+		dir = filepath.Join(dir, segments[i])
+	}
+
+	return decided
+}
+
+// fileRules returns the rules of the ignore file of dir, reading and caching
+// it on first use
+func (r *IgnoreRules) fileRules(dir string) []ignoreRule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rules, cached := r.files[dir]; cached {
+		return rules
+	}
+
+	rules := readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	r.files[dir] = rules
+	return rules
+}
+
+// readIgnoreFile parses an ignore file, a missing file has no rules
+func readIgnoreFile(path string) []ignoreRule {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if rule, ok := parseIgnoreRule(scanner.Text(), path, line); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreRule parses a gitignore pattern. Blank lines and comments
+// yield no rule.
+func parseIgnoreRule(pattern, source string, line int) (ignoreRule, bool) {
+	rule := ignoreRule{pattern: pattern, source: source, line: line}
+
+	p := strings.TrimRight(pattern, " \t\r")
+	if strings.HasSuffix(p, "\\") {
+		// The trailing space was escaped
+		p = pattern[:len(p)+1]
+	}
+	if p == "" || strings.HasPrefix(p, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(p, "!") {
+		rule.negated = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, "\\!") || strings.HasPrefix(p, "\\#") {
+		p = p[1:]
+	}
+
+	if strings.HasSuffix(p, "/") {
+		rule.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return rule, false
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the directory
+	// of its ignore file, otherwise it matches at any depth
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	rule.segments = strings.Split(p, "/")
+	if !anchored && rule.segments[0] != "**" {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	if rule.segments[len(rule.segments)-1] == "**" {
+		// "dir/**" matches everything inside dir, but not dir itself
+		rule.segments = append(rule.segments, "*")
+	}
+
+	return rule, true
+}
+
+// matches reports whether the rule matches the path made of segments,
+// relative to the directory of the rule
+func (rule *ignoreRule) matches(segments []string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(rule.segments, segments)
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// stands for any number of segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,133 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"homecloud/internal/models"
+)
+
+// writeIgnoreFile writes the ignore file of dir with one pattern per line
+func writeIgnoreFile(t *testing.T, dir string, patterns ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Join(patterns, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, IgnoreFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreFile(t, root,
+		"# comment",
+		"!keep.log",
+		"*.tmp",
+		"/anchored.txt",
+		"docs/**",
+		"*.bak",
+		"!*.bak",
+		"!first.cache",
+		"*.cache",
+	)
+	writeIgnoreFile(t, filepath.Join(root, "sub"),
+		"*.md",
+		"!keep.tmp",
+		"!*.log",
+	)
+	rules := NewIgnoreRules(root, []string{"*.log", "build/"})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		// Ignore files win over the global patterns
+		{"keep.log", false, false},
+		{"sub/a.log", false, false},
+		// Deeper ignore files win over their parents
+		{"x.tmp", false, true},
+		{"sub/x.tmp", false, true},
+		{"sub/keep.tmp", false, false},
+		{"sub/readme.md", false, true},
+		{"readme.md", false, false},
+		// A leading slash anchors to the directory of the ignore file
+		{"anchored.txt", false, true},
+		{"sub/anchored.txt", false, false},
+		// Directory patterns only match directories
+		{"build", true, true},
+		{"build", false, false},
+		// Nothing inside an ignored directory can be re-included
+		{"build/out.bin", false, true},
+		{"build/keep.log", false, true},
+		// "dir/**" matches the content of dir but not dir itself
+		{"docs", true, false},
+		{"docs/a/b.txt", false, true},
+		// Later rules win over earlier ones
+		{"a.bak", false, false},
+		{"first.cache", false, true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(root, filepath.FromSlash(test.path))
+		if got := rules.IsIgnored(path, test.isDir); got != test.want {
+			t.Errorf("IsIgnored(%q, %v) = %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreFile(t, filepath.Join(root, "sub"), "", "*.md")
+	rules := NewIgnoreRules(root, []string{"*.log"})
+
+	tests := []struct {
+		path string
+		want models.IgnoreMatch
+	}{
+		{"a.log", models.IgnoreMatch{Ignored: true, Pattern: "*.log", Source: ConfigIgnoreSource, Line: 1}},
+		{"sub/a.md", models.IgnoreMatch{Ignored: true, Pattern: "*.md", Source: filepath.Join(root, "sub", IgnoreFileName), Line: 2}},
+		{"a.md", models.IgnoreMatch{}},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(root, filepath.FromSlash(test.path))
+		test.want.Path = path
+		if got := rules.Match(path, false); got != test.want {
+			t.Errorf("Match(%q) = %+v, want %+v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestIgnoreRulesExcluded(t *testing.T) {
+	root := t.TempDir()
+	writeIgnoreFile(t, root, "!*")
+	rules := NewIgnoreRules(root, nil)
+	rules.SetExcluded([]string{"photos/2020"})
+
+	// Excluded folders win over every rule
+	path := filepath.Join(root, "photos", "2020", "a.jpg")
+	got := rules.Match(path, false)
+	if !got.Ignored || got.Source != ExcludedSource || got.Pattern != "photos/2020" {
+		t.Errorf("Match(%q) = %+v, want excluded by photos/2020", path, got)
+	}
+	if rules.IsIgnored(filepath.Join(root, "photos", "2021"), true) {
+		t.Errorf("photos/2021 is ignored, only photos/2020 is excluded")
+	}
+
+	// Changes to an ignore file apply once invalidated
+	writeIgnoreFile(t, root, "*.jpg")
+	path = filepath.Join(root, "b.jpg")
+	if rules.IsIgnored(path, false) {
+		t.Errorf("b.jpg is ignored before the rules were invalidated")
+	}
+	rules.Invalidate(filepath.Join(root, IgnoreFileName))
+	if !rules.IsIgnored(path, false) {
+		t.Errorf("b.jpg is not ignored after the rules were invalidated")
+	}
+}
@@ -0,0 +1,254 @@
+// internal/filesystem/notifywatcher.go
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"homecloud/internal/models"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// NotifyWatcher watches a directory tree through the notifications of the
+// operating system
+type NotifyWatcher struct {
+	watcherBase
+	fsWatcher *fsnotify.Watcher
+	dirs      map[string]struct{}
+}
+
+// NewNotifyWatcher creates a watcher using the notifications of the
+// operating system
+func NewNotifyWatcher(watchDir string, eventChan chan models.FileEvent, ignore *IgnoreRules) (*NotifyWatcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	return &NotifyWatcher{
+		watcherBase: newWatcherBase(watchDir, eventChan, ignore),
+		fsWatcher:   fsWatcher,
+		dirs:        make(map[string]struct{}),
+	}, nil
+}
+
+// Start begins watching the directory
+func (w *NotifyWatcher) Start() error {
+	if w.isWatching {
+		return fmt.Errorf("watcher is already running")
+	}
+
+	// Nothing created in the tree during registration needs reporting yet,
+	// the sync manager scans the whole tree when it starts
+	err := w.addTree(w.watchDir, func(string) {})
+	if err != nil {
+		return err
+	}
+
+	w.isWatching = true
+
+	go w.watchLoop()
+
+	return nil
+}
+
+// Stop stops the watcher
+func (w *NotifyWatcher) Stop() {
+	if !w.isWatching {
+		return
+	}
+
+	w.isWatching = false
+	close(w.stopChan)
+	w.fsWatcher.Close()
+}
+
+// Refresh watches the directories of the tree that are not watched yet
+func (w *NotifyWatcher) Refresh() error {
+	return w.addTree(w.watchDir, func(string) {})
+}
+
+// watchLoop processes file system events
+func (w *NotifyWatcher) watchLoop() {
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+
+			if IsIgnoreFile(event.Name) {
+				w.reloadIgnoreFile(event.Name)
+			}
+			if w.isIgnored(event.Name) {
+				continue
+			}
+
+			if !w.isSuppressed(event.Name) {
+				w.emit(w.getEventType(event), event.Name)
+			}
+
+			// After the event itself, so a new directory is reported before
+			// its content
+			w.trackDirectories(event)
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped, fsnotify.ErrEventOverflow for
+			// one
+			w.reportError(err)
+		}
+	}
+}
+
+// addTree watches dir and every directory below it. Each directory is
+// watched before its entries are listed, so anything created meanwhile is
+// either listed or reported by fsnotify. found is called with every entry
+// listed below dir.
+func (w *NotifyWatcher) addTree(dir string, found func(path string)) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && errors.Is(err, fs.ErrNotExist) {
+				// Removed while walking
+				return nil
+			}
+			return err
+		}
+
+		if path != dir {
+			if w.ignore != nil && w.ignore.IsIgnored(path, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			found(path)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		if err := w.fsWatcher.Add(path); err != nil {
+			if path != dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return fmt.Errorf("failed to add directory to watcher: %w", err)
+		}
+
+		w.mu.Lock()
+		w.dirs[path] = struct{}{}
+		w.mu.Unlock()
+
+		return nil
+	})
+}
+
+// trackDirectories keeps the set of watched directories in line with the
+// tree. New directories are watched along with everything below them, and
+// whatever was created inside before the watch was in place is reported as
+// created.
+func (w *NotifyWatcher) trackDirectories(event fsnotify.Event) {
+	if event.Has(fsnotify.Create) {
+		info, err := os.Lstat(event.Name)
+		if err != nil || !info.IsDir() {
+			return
+		}
+
+		err = w.addTree(event.Name, func(path string) {
+			if !w.isSuppressed(path) {
+				w.emit(models.EventCreated, path)
+			}
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.removeTree(event.Name)
+	}
+}
+
+// isIgnored reports whether events for path are left out. Removed paths
+// can no longer be checked on disk, they are directories if they were
+// watched.
+func (w *NotifyWatcher) isIgnored(path string) bool {
+	if w.ignore == nil {
+		return false
+	}
+
+	isDir := false
+	if info, err := os.Lstat(path); err == nil {
+		isDir = info.IsDir()
+	} else {
+		w.mu.Lock()
+		_, isDir = w.dirs[path]
+		w.mu.Unlock()
+	}
+
+	return w.ignore.IsIgnored(path, isDir)
+}
+
+// reloadIgnoreFile applies a changed ignore file. Directories it no longer
+// ignores start being watched, the ones it now ignores are only dropped on
+// the next start.
+func (w *NotifyWatcher) reloadIgnoreFile(path string) {
+	if w.ignore == nil {
+		return
+	}
+	w.ignore.Invalidate(path)
+
+	dir := filepath.Dir(path)
+	w.mu.Lock()
+	_, watched := w.dirs[dir]
+	w.mu.Unlock()
+	if !watched {
+		return
+	}
+
+	if err := w.addTree(dir, func(string) {}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
+
+// removeTree stops watching dir and every directory below it
+func (w *NotifyWatcher) removeTree(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, exists := w.dirs[dir]; !exists {
+		return
+	}
+
+	prefix := dir + string(filepath.Separator)
+	for path := range w.dirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			// fsnotify already dropped the watches of removed directories
+			w.fsWatcher.Remove(path)
+			delete(w.dirs, path)
+		}
+	}
+}
+
+// getEventType determines the type of file event
+func (w *NotifyWatcher) getEventType(event fsnotify.Event) models.FileEventType {
+	if event.Has(fsnotify.Create) {
+		return models.EventCreated
+	} else if event.Has(fsnotify.Write) {
+		return models.EventModified
+	} else if event.Has(fsnotify.Remove) {
+		return models.EventDeleted
+	} else if event.Has(fsnotify.Rename) {
+		return models.EventRenamed
+	}
+	return models.EventModified // Default
+}
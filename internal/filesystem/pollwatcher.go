@@ -0,0 +1,273 @@
+// internal/filesystem/pollwatcher.go
+package filesystem
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"homecloud/internal/models"
+	"homecloud/pkg/common"
+)
+
+// PollingWatcher watches a directory tree by comparing snapshots of it on
+// an interval. It is slower to notice changes than NotifyWatcher but needs
+// nothing from the filesystem beyond listing directories.
+type PollingWatcher struct {
+	watcherBase
+	interval time.Duration
+	snapshot map[string]entryState
+}
+
+// entryState is what a snapshot records about a file
+type entryState struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+	fileID  uint64
+}
+
+// NewPollingWatcher creates a watcher polling the tree every interval
+func NewPollingWatcher(watchDir string, eventChan chan models.FileEvent, ignore *IgnoreRules, interval time.Duration) *PollingWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	return &PollingWatcher{
+		watcherBase: newWatcherBase(watchDir, eventChan, ignore),
+		interval:    interval,
+	}
+}
+
+// Start takes the first snapshot and begins polling
+func (w *PollingWatcher) Start() error {
+	if w.isWatching {
+		return fmt.Errorf("watcher is already running")
+	}
+
+	snapshot, err := w.scan()
+	if err != nil {
+		return err
+	}
+	w.snapshot = snapshot
+
+	w.isWatching = true
+
+	go w.pollLoop()
+
+	return nil
+}
+
+// Stop stops the watcher
+func (w *PollingWatcher) Stop() {
+	if !w.isWatching {
+		return
+	}
+
+	w.isWatching = false
+	close(w.stopChan)
+}
+
+// Refresh does nothing, every poll walks the whole tree with the current
+// ignore rules and reports what they no longer skip as created
+func (w *PollingWatcher) Refresh() error {
+	return nil
+}
+
+// pollLoop takes a snapshot on every interval and reports what changed
+// since the previous one
+func (w *PollingWatcher) pollLoop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		snapshot, err := w.scan()
+		if err != nil {
+			// The mount may be gone for a moment, compare with the last
+			// good snapshot next time
+			w.reportError(err)
+			continue
+		}
+
+		events := diffSnapshots(w.snapshot, snapshot)
+		w.snapshot = snapshot
+
+		for _, event := range events {
+			if IsIgnoreFile(event.path) && w.ignore != nil {
+				w.ignore.Invalidate(event.path)
+			}
+			if !w.isSuppressed(event.path) {
+				w.emit(event.eventType, event.path)
+			}
+		}
+	}
+}
+
+// scan records the state of every path in the tree that is not ignored
+func (w *PollingWatcher) scan() (map[string]entryState, error) {
+	snapshot := make(map[string]entryState)
+
+	err := filepath.WalkDir(w.watchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != w.watchDir && errors.Is(err, fs.ErrNotExist) {
+				// Removed while walking
+				return nil
+			}
+			return err
+		}
+		if path == w.watchDir {
+			return nil
+		}
+
+		if w.ignore != nil && w.ignore.IsIgnored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		snapshot[path] = entryState{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			isDir:   info.IsDir(),
+			fileID:  common.FileID(path, info),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", w.watchDir, err)
+	}
+
+	return snapshot, nil
+}
+
+// snapshotEvent is a change found between two snapshots
+type snapshotEvent struct {
+	eventType models.FileEventType
+	path      string
+}
+
+// diffSnapshots returns the events turning before into after. A path gone
+// while another with the same file ID appeared is reported as renamed then
+// created, like the native backend does, and the content of a renamed
+// directory is not reported at all unless it changed. Events come in an
+// order the sync can apply: renames, creations parents first,
+// modifications, then deletions.
+func diffSnapshots(before, after map[string]entryState) []snapshotEvent {
+	var gone, added []string
+	for path := range before {
+		if _, exists := after[path]; !exists {
+			gone = append(gone, path)
+		}
+	}
+	for path := range after {
+		if _, exists := before[path]; !exists {
+			added = append(added, path)
+		}
+	}
+	slices.SortFunc(gone, comparePaths)
+	slices.SortFunc(added, comparePaths)
+
+	byFileID := make(map[uint64]string, len(added))
+	for _, path := range added {
+		if id := after[path].fileID; id != 0 {
+			byFileID[id] = path
+		}
+	}
+
+	var events, modified []snapshotEvent
+	matched := make(map[string]bool)
+	movedDirs := make(map[string]string)
+
+	for _, oldPath := range gone {
+		old := before[oldPath]
+
+		// Inside a directory that was renamed, it moved along with it
+		if newPath, ok := movedPath(movedDirs, oldPath); ok {
+			if state, exists := after[newPath]; exists && !matched[newPath] && state.isDir == old.isDir {
+				matched[oldPath], matched[newPath] = true, true
+				if !state.isDir && (state.size != old.size || !state.modTime.Equal(old.modTime)) {
+					modified = append(modified, snapshotEvent{models.EventModified, newPath})
+				}
+				continue
+			}
+		}
+
+		newPath, ok := byFileID[old.fileID]
+		if old.fileID == 0 || !ok || matched[newPath] || after[newPath].isDir != old.isDir {
+			continue
+		}
+
+		matched[oldPath], matched[newPath] = true, true
+		events = append(events,
+			snapshotEvent{models.EventRenamed, oldPath},
+			snapshotEvent{models.EventCreated, newPath},
+		)
+		if old.isDir {
+			movedDirs[oldPath] = newPath
+		}
+	}
+
+	for _, path := range added {
+		if !matched[path] {
+			events = append(events, snapshotEvent{models.EventCreated, path})
+		}
+	}
+
+	for path, state := range after {
+		old, existed := before[path]
+		if !existed || state.isDir {
+			continue
+		}
+		if state.size != old.size || !state.modTime.Equal(old.modTime) || state.fileID != old.fileID {
+			modified = append(modified, snapshotEvent{models.EventModified, path})
+		}
+	}
+	slices.SortFunc(modified, func(a, b snapshotEvent) int { return comparePaths(a.path, b.path) })
+	events = append(events, modified...)
+
+	// Deepest first, a directory is deleted after its content
+	for i := len(gone) - 1; i >= 0; i-- {
+		if !matched[gone[i]] {
+			events = append(events, snapshotEvent{models.EventDeleted, gone[i]})
+		}
+	}
+
+	return events
+}
+
+// movedPath returns where path ended up if one of its parent directories
+// was renamed
+func movedPath(movedDirs map[string]string, path string) (string, bool) {
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if newDir, ok := movedDirs[dir]; ok {
+			rel := strings.TrimPrefix(path, dir+string(filepath.Separator))
+			return filepath.Join(newDir, rel), true
+		}
+	}
+	return "", false
+}
+
+// comparePaths orders paths parents first
+func comparePaths(a, b string) int {
+	if c := cmp.Compare(strings.Count(a, string(filepath.Separator)), strings.Count(b, string(filepath.Separator))); c != 0 {
+		return c
+	}
+	return cmp.Compare(a, b)
+}
@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// snapshot builds a snapshot from slash-separated paths
+func snapshot(entries map[string]entryState) map[string]entryState {
+	result := make(map[string]entryState, len(entries))
+	for path, state := range entries {
+		result[filepath.FromSlash(path)] = state
+	}
+	return result
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := func(size int64, id uint64) entryState { return entryState{size: size, modTime: at, fileID: id} }
+	d := func(id uint64) entryState { return entryState{isDir: true, modTime: at, fileID: id} }
+
+	tests := []struct {
+		name          string
+		before, after map[string]entryState
+		want          []string
+	}{
+		{
+			name:   "unchanged",
+			before: map[string]entryState{"a": f(1, 1)},
+			after:  map[string]entryState{"a": f(1, 1)},
+			want:   []string{},
+		},
+		{
+			name:   "created parents first",
+			before: map[string]entryState{},
+			after:  map[string]entryState{"d/x": f(1, 2), "d": d(1), "a": f(1, 3)},
+			want:   []string{"CREATED a", "CREATED d", "CREATED d/x"},
+		},
+		{
+			name:   "deleted deepest first",
+			before: map[string]entryState{"d": d(1), "d/x": f(1, 2), "a": f(1, 3)},
+			after:  map[string]entryState{},
+			want:   []string{"DELETED d/x", "DELETED d", "DELETED a"},
+		},
+		{
+			name:   "modified",
+			before: map[string]entryState{"size": f(1, 1), "time": f(1, 2), "replaced": f(1, 3), "dir": d(4)},
+			after: map[string]entryState{
+				"size": f(2, 1), "time": {size: 1, modTime: at.Add(time.Second), fileID: 2}, "replaced": f(1, 5),
+				"dir": {isDir: true, modTime: at.Add(time.Second), fileID: 4},
+			},
+			want: []string{"MODIFIED replaced", "MODIFIED size", "MODIFIED time"},
+		},
+		{
+			name:   "renamed file",
+			before: map[string]entryState{"a": f(1, 1)},
+			after:  map[string]entryState{"b": f(1, 1)},
+			want:   []string{"RENAMED a", "CREATED b"},
+		},
+		{
+			name:   "renamed directory",
+			before: map[string]entryState{"d": d(1), "d/x": f(1, 2), "d/y": f(1, 3)},
+			after:  map[string]entryState{"e": d(1), "e/x": f(1, 2), "e/y": f(2, 3)},
+			want:   []string{"RENAMED d", "CREATED e", "MODIFIED e/y"},
+		},
+		{
+			name:   "no rename without file ID",
+			before: map[string]entryState{"a": f(1, 0)},
+			after:  map[string]entryState{"b": f(1, 0)},
+			want:   []string{"CREATED b", "DELETED a"},
+		},
+		{
+			name:   "no rename between a file and a directory",
+			before: map[string]entryState{"a": f(1, 1)},
+			after:  map[string]entryState{"b": d(1)},
+			want:   []string{"CREATED b", "DELETED a"},
+		},
+		{
+			name:   "everything at once",
+			before: map[string]entryState{"old": f(1, 1), "edited": f(1, 2), "gone": f(1, 3)},
+			after:  map[string]entryState{"new": f(1, 1), "edited": f(2, 2), "added": f(1, 4)},
+			want:   []string{"RENAMED old", "CREATED new", "CREATED added", "MODIFIED edited", "DELETED gone"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := diffSnapshots(snapshot(test.before), snapshot(test.after))
+			got := make([]string, 0, len(events))
+			for _, event := range events {
+				got = append(got, string(event.eventType)+" "+filepath.ToSlash(event.path))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("diffSnapshots() =\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
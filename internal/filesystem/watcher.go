@@ -4,105 +4,159 @@ package filesystem
 import (
 	"fmt"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"homecloud/internal/models"
+)
+
+// Watcher reports changes of a directory tree as file events
+type Watcher interface {
+	// Start begins watching the directory
+	Start() error
+	// Stop stops the watcher
+	Stop()
+	// Suppress ignores events for a path until the returned function is
+	// called, so changes made by the sync itself are not reported back
+	Suppress(path string) func()
+	// SetErrorHandler sets a function called with every error of the
+	// watcher. It must be set before Start.
+	SetErrorHandler(handler func(err error))
+	// Refresh starts watching the directories the ignore rules no longer
+	// skip after they were changed
+	Refresh() error
+}
 
-	"github.com/fsnotify/fsnotify"
+// Backend selects how a Watcher learns about changes
+type Backend string
+
+const (
+	// BackendNative uses the notifications of the operating system
+	BackendNative Backend = "native"
+	// BackendPolling compares snapshots of the tree on an interval. It works
+	// where notifications do not, such as NFS and SMB mounts, FUSE
+	// filesystems and some container volumes.
+	BackendPolling Backend = "polling"
 )
 
-// Watcher watches a directory for changes
-type Watcher struct {
+// DefaultPollInterval is the interval of the polling backend when none is
+// configured
+const DefaultPollInterval = 10 * time.Second
+
+// NewWatcher creates a watcher of watchDir using backend, which defaults to
+// the native one. Events are sent to eventChan. Paths matched by ignore are
+// neither watched nor reported, ignore may be nil. pollInterval is only
+// used by the polling backend.
+func NewWatcher(backend Backend, watchDir string, eventChan chan models.FileEvent, ignore *IgnoreRules, pollInterval time.Duration) (Watcher, error) {
+	switch backend {
+	case "", BackendNative:
+		return NewNotifyWatcher(watchDir, eventChan, ignore)
+	case BackendPolling:
+		return NewPollingWatcher(watchDir, eventChan, ignore, pollInterval), nil
+	}
+	return nil, fmt.Errorf("unknown watcher backend %q", backend)
+}
+
+// watcherBase holds what every backend shares: where events go, which
+// paths are suppressed or ignored and the error handler
+type watcherBase struct {
 	watchDir   string
 	eventChan  chan models.FileEvent
-	fsWatcher  *fsnotify.Watcher
 	stopChan   chan struct{}
 	isWatching bool
+	mu         sync.Mutex
+	suppressed map[string]*suppression
+	ignore     *IgnoreRules
+	onError    func(err error)
 }
 
-// NewWatcher creates a new file system watcher
-func NewWatcher(watchDir string, eventChan chan models.FileEvent) (*Watcher, error) {
-	fsWatcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create watcher: %w", err)
-	}
+// suppressGrace is how long events stay ignored after a suppression is
+// released, since they are delivered asynchronously
+const suppressGrace = 500 * time.Millisecond
 
-	return &Watcher{
+// suppression tracks why and until when events for a path are ignored
+type suppression struct {
+	active int
+	until  time.Time
+}
+
+// newWatcherBase creates the shared state of a watcher
+func newWatcherBase(watchDir string, eventChan chan models.FileEvent, ignore *IgnoreRules) watcherBase {
+	return watcherBase{
 		watchDir:   watchDir,
 		eventChan:  eventChan,
-		fsWatcher:  fsWatcher,
 		stopChan:   make(chan struct{}),
 		isWatching: false,
-	}, nil
+		suppressed: make(map[string]*suppression),
+		ignore:     ignore,
+	}
 }
 
-// Start begins watching the directory
-func (w *Watcher) Start() error {
-	if w.isWatching {
-		return fmt.Errorf("watcher is already running")
-	}
+// SetErrorHandler sets a function called with every error of the watcher.
+// Errors mean events may have been missed. It must be set before Start.
+func (w *watcherBase) SetErrorHandler(handler func(err error)) {
+	w.onError = handler
+}
 
-	err := w.fsWatcher.Add(w.watchDir)
-	if err != nil {
-		return fmt.Errorf("failed to add directory to watcher: %w", err)
+// reportError logs an error of the watcher and passes it to the handler
+func (w *watcherBase) reportError(err error) {
+	fmt.Printf("Error: %v\n", err)
+	if w.onError != nil {
+		w.onError(err)
 	}
-
-	w.isWatching = true
-
-	go w.watchLoop()
-
-	return nil
 }
 
-// Stop stops the watcher
-func (w *Watcher) Stop() {
-	if !w.isWatching {
-		return
+// emit reports an event unless the watcher is being stopped
+func (w *watcherBase) emit(eventType models.FileEventType, path string) {
+	select {
+	case w.eventChan <- models.FileEvent{
+		Type:      eventType,
+		Path:      path,
+		Timestamp: time.Now(),
+	}:
+	case <-w.stopChan:
 	}
-
-	w.isWatching = false
-	close(w.stopChan)
-	w.fsWatcher.Close()
 }
 
-// watchLoop processes file system events
-func (w *Watcher) watchLoop() {
-	for {
-		select {
-		case <-w.stopChan:
-			return
-		case event, ok := <-w.fsWatcher.Events:
-			if !ok {
-				return
-			}
-
-			eventType := w.getEventType(event)
-			w.eventChan <- models.FileEvent{
-				Type:      eventType,
-				Path:      event.Name,
-				Timestamp: time.Now(),
-			}
-		case err, ok := <-w.fsWatcher.Errors:
-			if !ok {
-				return
-			}
-			fmt.Printf("Error: %v\n", err)
-		}
+// Suppress ignores events for path until the returned function is called,
+// and for a short grace period after that. It is used for changes made by
+// the sync itself, which must not be reported back as local edits.
+func (w *watcherBase) Suppress(path string) func() {
+	w.mu.Lock()
+	s, exists := w.suppressed[path]
+	if !exists {
+		s = &suppression{}
+		w.suppressed[path] = s
+	}
+	s.active++
+	w.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			s.active--
+			s.until = time.Now().Add(suppressGrace)
+			w.mu.Unlock()
+		})
 	}
 }
 
-// getEventType determines the type of file event
-func (w *Watcher) getEventType(event fsnotify.Event) models.FileEventType {
-	if event.Has(fsnotify.Create) {
-		return models.EventCreated
-	} else if event.Has(fsnotify.Write) {
-		return models.EventModified
-	} else if event.Has(fsnotify.Remove) {
-		return models.EventDeleted
-	} else if event.Has(fsnotify.Rename) {
-		return models.EventRenamed
+// isSuppressed reports whether events for path are currently ignored
+func (w *watcherBase) isSuppressed(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, exists := w.suppressed[path]
+	if !exists {
+		return false
 	}
-	return models.EventModified // Default
+	if s.active > 0 || time.Now().Before(s.until) {
+		return true
+	}
+
+	delete(w.suppressed, path)
+	return false
 }
 
 // GetFileName extracts the filename from a path
@@ -0,0 +1,107 @@
+package hashing
+
+import (
+	"fmt"
+	"hash"
+	"os"
+	"time"
+
+	"homecloud/pkg/common"
+)
+
+// Cache keeps the checksums of files by file ID, size and modification
+// time. A file keeps its ID while edited in place, the size and
+// modification time tell whether the cached checksum still matches.
+type Cache interface {
+	// GetChecksum returns the cached checksum, empty when there is none
+	GetChecksum(fileID uint64, size int64, modTime time.Time, algorithm string) (string, error)
+	SaveChecksum(fileID uint64, size int64, modTime time.Time, algorithm, checksum string) error
+}
+
+// Hasher computes checksums with one algorithm, through a cache and a
+// bounded number of workers
+type Hasher struct {
+	algorithm Algorithm
+	cache     Cache
+	// pool holds a token for every file being read
+	pool chan struct{}
+}
+
+// NewHasher creates a hasher computing checksums with algorithm, reading up
+// to workers files at once, DefaultWorkers if workers is not positive. cache
+// may be nil.
+func NewHasher(algorithm Algorithm, cache Cache, workers int) *Hasher {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Hasher{algorithm: algorithm, cache: cache, pool: make(chan struct{}, workers)}
+}
+
+// Algorithm returns the algorithm of the checksums the hasher computes
+func (h *Hasher) Algorithm() Algorithm {
+	return h.algorithm
+}
+
+// NewHash returns a hash of the hasher's algorithm, for content that is
+// not read from a file
+func (h *Hasher) NewHash() hash.Hash {
+	// The algorithm was checked when the hasher was created
+	digest, _ := h.algorithm.New()
+	return digest
+}
+
+// Remember caches checksum as the checksum of the file at path, as known
+// after writing it
+func (h *Hasher) Remember(path, checksum string) {
+	stat, err := os.Stat(path)
+	if err != nil || h.cache == nil {
+		return
+	}
+	if fileID := common.FileID(path, stat); fileID != 0 {
+		if err := h.cache.SaveChecksum(fileID, stat.Size(), stat.ModTime(), string(h.algorithm), checksum); err != nil {
+			fmt.Printf("failed to cache checksum of %s: %v\n", path, err)
+		}
+	}
+}
+
+// Checksum returns the checksum of the file at path
+func (h *Hasher) Checksum(path string) (string, error) {
+	return h.ChecksumWith(path, h.algorithm)
+}
+
+// ChecksumWith returns the checksum of the file at path computed with
+// algorithm, such as the one of a checksum recorded earlier
+func (h *Hasher) ChecksumWith(path string, algorithm Algorithm) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	// Without an ID the file cannot be told apart from another one of the
+	// same size and time
+	fileID := common.FileID(path, stat)
+	cached := h.cache != nil && fileID != 0
+
+	if cached {
+		checksum, err := h.cache.GetChecksum(fileID, stat.Size(), stat.ModTime(), string(algorithm))
+		if err == nil && checksum != "" {
+			return checksum, nil
+		}
+	}
+
+	h.pool <- struct{}{}
+	checksum, err := File(path, algorithm)
+	<-h.pool
+	if err != nil {
+		return "", err
+	}
+
+	// A file written to while it was read gets hashed again next time
+	if after, err := os.Stat(path); cached && err == nil && after.Size() == stat.Size() && after.ModTime().Equal(stat.ModTime()) {
+		if err := h.cache.SaveChecksum(fileID, stat.Size(), stat.ModTime(), string(algorithm), checksum); err != nil {
+			fmt.Printf("failed to cache checksum of %s: %v\n", path, err)
+		}
+	}
+
+	return checksum, nil
+}
@@ -0,0 +1,184 @@
+package hashing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"homecloud/internal/storage"
+	"homecloud/pkg/common"
+)
+
+// The checksums of "abc"
+const (
+	sha256ABC = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	blake3ABC = "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"
+)
+
+// newStore returns a metadata store in a temporary directory
+func newStore(t *testing.T) *storage.MetadataStore {
+	t.Helper()
+
+	store, err := storage.NewMetadataStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMetadataStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// writeFile writes content to a file in a temporary directory and returns
+// its path
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// cacheKey returns the file ID, size and modification time a checksum of
+// the file at path is cached under
+func cacheKey(t *testing.T, path string) (uint64, int64, time.Time) {
+	t.Helper()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileID := common.FileID(path, stat)
+	if fileID == 0 {
+		t.Skip("the filesystem has no file IDs")
+	}
+	return fileID, stat.Size(), stat.ModTime()
+}
+
+func TestChecksum(t *testing.T) {
+	path := writeFile(t, "abc")
+
+	tests := []struct {
+		algorithm Algorithm
+		want      string
+	}{
+		{SHA256, sha256ABC},
+		{BLAKE3, blake3ABC},
+	}
+	for _, test := range tests {
+		if got, err := NewHasher(test.algorithm, nil, 0).Checksum(path); err != nil || got != test.want {
+			t.Errorf("%s checksum = %s, %v, want %s", test.algorithm, got, err, test.want)
+		}
+		if got, err := NewHasher(DefaultAlgorithm, nil, 0).ChecksumWith(path, test.algorithm); err != nil || got != test.want {
+			t.Errorf("ChecksumWith(%s) = %s, %v, want %s", test.algorithm, got, err, test.want)
+		}
+	}
+}
+
+func TestChecksumCache(t *testing.T) {
+	store := newStore(t)
+	path := writeFile(t, "abc")
+	fileID, size, modTime := cacheKey(t, path)
+
+	// A cached checksum is trusted without reading the file
+	if err := store.SaveChecksum(fileID, size, modTime, string(SHA256), "cached"); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHasher(SHA256, store, 0)
+	if got, err := h.Checksum(path); err != nil || got != "cached" {
+		t.Fatalf("Checksum() of an unchanged file = %s, %v, want the cached one", got, err)
+	}
+
+	// A new modification time or size means the file changed
+	later := modTime.Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := h.Checksum(path); err != nil || got != sha256ABC {
+		t.Fatalf("Checksum() after touching the file = %s, %v, want %s", got, err, sha256ABC)
+	}
+
+	// What was computed is cached for the next time
+	if cached, err := store.GetChecksum(fileID, size, later, string(SHA256)); err != nil || cached != sha256ABC {
+		t.Errorf("GetChecksum() = %s, %v, want %s", cached, err, sha256ABC)
+	}
+
+	// Edited in place without the modification time moving on
+	if err := os.WriteFile(path, []byte("abcd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	want, err := File(path, SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := h.Checksum(path); err != nil || got != want {
+		t.Errorf("Checksum() after changing the size = %s, %v, want %s", got, err, want)
+	}
+}
+
+func TestChecksumCacheAlgorithms(t *testing.T) {
+	store := newStore(t)
+	path := writeFile(t, "abc")
+	fileID, size, modTime := cacheKey(t, path)
+
+	h := NewHasher(SHA256, store, 0)
+	if _, err := h.Checksum(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.ChecksumWith(path, BLAKE3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each algorithm keeps its own checksum, neither replaces the other
+	for algorithm, want := range map[Algorithm]string{SHA256: sha256ABC, BLAKE3: blake3ABC, MD5: ""} {
+		if got, err := store.GetChecksum(fileID, size, modTime, string(algorithm)); err != nil || got != want {
+			t.Errorf("GetChecksum(%s) = %q, %v, want %q", algorithm, got, err, want)
+		}
+	}
+
+	other := NewHasher(BLAKE3, store, 0)
+	other.Remember(path, "remembered")
+	if got, err := other.Checksum(path); err != nil || got != "remembered" {
+		t.Errorf("Checksum() after Remember() = %s, %v, want the remembered one", got, err)
+	}
+	if got, err := h.Checksum(path); err != nil || got != sha256ABC {
+		t.Errorf("%s checksum after remembering a %s one = %s, %v, want %s", SHA256, BLAKE3, got, err, sha256ABC)
+	}
+}
+
+func TestChecksumWorkers(t *testing.T) {
+	path := writeFile(t, "abc")
+	h := NewHasher(SHA256, nil, 2)
+	if workers := cap(h.pool); workers != 2 {
+		t.Fatalf("hasher has %d workers, want 2", workers)
+	}
+	if workers := cap(NewHasher(SHA256, nil, 0).pool); workers != DefaultWorkers {
+		t.Errorf("hasher without a worker count has %d workers, want %d", workers, DefaultWorkers)
+	}
+
+	// With every worker busy, files wait for one to be free
+	h.pool <- struct{}{}
+	h.pool <- struct{}{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Checksum(path)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Checksum() did not wait for a free worker")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-h.pool
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Checksum() did not run once a worker was free")
+	}
+}
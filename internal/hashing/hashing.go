@@ -0,0 +1,86 @@
+// Package hashing computes the content checksums the sync compares files
+// with. Results are cached by file ID, size and modification time, so a file
+// is only read again once it changed.
+package hashing
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Algorithm names a checksum algorithm
+type Algorithm string
+
+const (
+	SHA256 Algorithm = "sha256"
+	BLAKE3 Algorithm = "blake3"
+	// MD5 is what checksums were computed with before algorithms could be
+	// chosen. It is only used to compare files with those checksums.
+	MD5 Algorithm = "md5"
+)
+
+// DefaultAlgorithm is used when none is configured
+const DefaultAlgorithm = SHA256
+
+// ParseAlgorithm returns the algorithm named name, the default one when
+// name is empty. Only algorithms that can be chosen for new checksums are
+// accepted.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch algorithm := Algorithm(strings.ToLower(name)); algorithm {
+	case "":
+		return DefaultAlgorithm, nil
+	case SHA256, BLAKE3:
+		return algorithm, nil
+	default:
+		return "", fmt.Errorf("unknown hash algorithm %q, expected sha256 or blake3", name)
+	}
+}
+
+// New returns a hash computing checksums with the algorithm
+func (a Algorithm) New() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case BLAKE3:
+		return blake3.New(32, nil), nil
+	case MD5:
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", a)
+	}
+}
+
+// DefaultWorkers is how many files a hasher reads at once unless told
+// otherwise. Hashing is limited by the disk as much as by the CPU, more at
+// once only makes them compete.
+var DefaultWorkers = min(runtime.NumCPU(), 4)
+
+// File computes the checksum of the file at path with algorithm, as a hex
+// string. It neither waits for a hasher's workers nor uses a cache.
+func File(path string, algorithm Algorithm) (string, error) {
+	h, err := algorithm.New()
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
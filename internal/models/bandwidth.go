@@ -0,0 +1,15 @@
+package models
+
+// BandwidthLimits caps the transfer rates in bytes per second. Zero means
+// unlimited.
+type BandwidthLimits struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+}
+
+// BandwidthProfile replaces the default limits while one of its windows
+// is open, such as a lower cap during working hours
+type BandwidthProfile struct {
+	Windows []SyncWindow    `json:"windows"`
+	Limits  BandwidthLimits `json:"limits"`
+}
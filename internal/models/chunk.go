@@ -0,0 +1,9 @@
+package models
+
+// Chunk is a piece of a file cut at a content-defined boundary and addressed
+// by the hash of its content. The chunks of a file in order make up its
+// manifest.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// ConflictResolution tells how a conflict should be resolved
+type ConflictResolution string
+
+const (
+	// ResolveKeepLocal replaces the file with the conflicted copy
+	ResolveKeepLocal ConflictResolution = "KEEP_LOCAL"
+	// ResolveKeepRemote discards the conflicted copy
+	ResolveKeepRemote ConflictResolution = "KEEP_REMOTE"
+	// ResolveKeepBoth keeps both files and dismisses the conflict
+	ResolveKeepBoth ConflictResolution = "KEEP_BOTH"
+)
+
+// Conflict records a file that was changed locally and remotely between
+// two syncs. The remote version stays at Path and the local version is
+// kept next to it at CopyPath.
+type Conflict struct {
+	Path       string    `json:"path"`
+	CopyPath   string    `json:"copyPath"`
+	Device     string    `json:"device"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
@@ -12,6 +12,7 @@ const (
 	StatusSyncing   SyncStatus = "SYNCING"
 	StatusSynced    SyncStatus = "SYNCED"
 	StatusError     SyncStatus = "ERROR"
+	StatusConflict  SyncStatus = "CONFLICT"
 )
 
 // FileInfo represents a file's sync information
@@ -26,6 +27,15 @@ type FileInfo struct {
 	Checksum     string                `json:"checksum,omitempty"`
 	LastSynced   time.Time             `json:"lastSynced"`
 	FilesContent map[string]*FileInfo  `json:"filesContent,omitempty"`
+	Error        string                `json:"error,omitempty"`
+	Inode        uint64                `json:"inode,omitempty"`
+	// Retries counts the failed attempts since the file last synced, and
+	// NextRetry is when the next one is due, zero when the error is not
+	// retried on its own
+	Retries   int       `json:"retries,omitempty"`
+	NextRetry time.Time `json:"nextRetry"`
+	// ChecksumAlgorithm is the algorithm Checksum was computed with
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty"`
 }
 
 // FileEvent represents a file system event
@@ -0,0 +1,24 @@
+package models
+
+// SyncFolder summarizes a synced local directory
+type SyncFolder struct {
+	Path string `json:"path"`
+	// RemotePath is the server directory the folder is synced with, empty
+	// for the root of the server
+	RemotePath string `json:"remotePath"`
+	Running    bool   `json:"running"`
+	Paused     bool   `json:"paused"`
+	Pausing    bool   `json:"pausing"`
+	Files      int    `json:"files"`
+	Pending    int    `json:"pending"`
+	Errors     int    `json:"errors"`
+	Conflicts  int    `json:"conflicts"`
+}
+
+// RemoteFolder is a server folder as shown by selective sync
+type RemoteFolder struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	// Selected tells whether the folder is mirrored locally
+	Selected bool `json:"selected"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// IgnoreMatch explains whether a path is left out of the sync and which
+// rule decided it
+type IgnoreMatch struct {
+	Path    string `json:"path"`
+	Ignored bool   `json:"ignored"`
+	// Pattern is the deciding rule as written, empty when no rule matched
+	Pattern string `json:"pattern,omitempty"`
+	// Source is the ignore file holding the rule, or "config" for the
+	// global patterns
+	Source string `json:"source,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// SyncWindow is a recurring period of time, such as every night from 22:00
+// to 06:00 or the whole weekend
+type SyncWindow struct {
+	// Days are the days the window starts on, "mon" to "sun". The window
+	// recurs every day when empty.
+	Days []string `json:"days,omitempty"`
+	// Start and End are times of day formatted as "15:04". A window ending
+	// before it starts runs past midnight, one without them lasts the whole
+	// day.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// SyncSchedule limits transfers to time windows. A direction without
+// windows is never limited.
+type SyncSchedule struct {
+	Upload   []SyncWindow `json:"upload,omitempty"`
+	Download []SyncWindow `json:"download,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// UploadSession tracks a resumable upload that is in progress
+type UploadSession struct {
+	Path       string    `json:"path"`
+	SessionID  string    `json:"sessionId"`
+	RemotePath string    `json:"remotePath"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	Offset     int64     `json:"offset"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
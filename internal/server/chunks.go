@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"homecloud/internal/models"
+)
+
+// MissingChunks returns the hashes among hashes of the chunks the server
+// does not have yet
+func (c *Client) MissingChunks(hashes []string) ([]string, error) {
+	if c.authToken == "" {
+		return nil, ErrAuthExpired
+	}
+
+	data, err := json.Marshal(map[string][]string{"chunks": hashes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chunk request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/chunks/missing", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, requestError("missing chunks", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("missing chunks", resp)
+	}
+
+	var result struct {
+		Missing []string `json:"missing"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse missing chunks: %w", err)
+	}
+
+	return result.Missing, nil
+}
+
+// PutChunk uploads the data of the chunk with hash. The server checks the
+// data against the hash. Cancelling ctx stops the upload.
+func (c *Client) PutChunk(ctx context.Context, hash string, data []byte) error {
+	if c.authToken == "" {
+		return ErrAuthExpired
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", c.baseURL+"/api/chunks/"+url.PathEscape(hash), c.uploadLimiter.Reader(ctx, bytes.NewReader(data)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.transferClient.Do(req)
+	if err != nil {
+		return requestError("chunk upload", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError("chunk upload", resp)
+	}
+
+	return nil
+}
+
+// CommitManifest creates or replaces path with the file made of chunks, which
+// the server must all have. The metadata is stored as with UploadFile.
+func (c *Client) CommitManifest(path string, chunks []models.Chunk, metadata map[string]string) error {
+	if c.authToken == "" {
+		return ErrAuthExpired
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"path":     path,
+		"chunks":   chunks,
+		"metadata": metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/files/manifest", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.transferClient.Do(req)
+	if err != nil {
+		return requestError("commit manifest", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError("commit manifest", resp)
+	}
+
+	return nil
+}
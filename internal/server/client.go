@@ -2,20 +2,33 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"time"
 
+	"homecloud/internal/hashing"
 	"homecloud/internal/models"
 )
 
 // Client handles communication with the remote server
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	authToken  string
+	baseURL        string
+	httpClient     *http.Client
+	transferClient *http.Client
+	authToken      string
+	// checksumAlgorithm is the algorithm the server is asked to report
+	// checksums with
+	checksumAlgorithm hashing.Algorithm
+	// Uploads and downloads are limited separately, each limit is shared by
+	// all transfers of its direction
+	uploadLimiter   *RateLimiter
+	downloadLimiter *RateLimiter
 }
 
 // NewClient creates a new server client
@@ -25,9 +38,35 @@ func NewClient(baseURL string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		// Transfers of large files can legitimately take longer than any
+		// fixed timeout, so only waiting on the server is bounded
+		transferClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+			},
+		},
+		checksumAlgorithm: hashing.DefaultAlgorithm,
+		uploadLimiter:     NewRateLimiter(0),
+		downloadLimiter:   NewRateLimiter(0),
 	}
 }
 
+// SetChecksumAlgorithm sets the algorithm the server reports checksums
+// with, it must be the one local files are hashed with
+func (c *Client) SetChecksumAlgorithm(algorithm hashing.Algorithm) {
+	c.checksumAlgorithm = algorithm
+}
+
+// SetBandwidthLimits caps uploads and downloads to the given number of bytes
+// per second, zero meaning unlimited. Transfers in progress are slowed down
+// or sped up too.
+func (c *Client) SetBandwidthLimits(upload, download int64) {
+	c.uploadLimiter.SetRate(upload)
+	c.downloadLimiter.SetRate(download)
+}
+
 // Authenticate authenticates with the server and stores the token
 func (c *Client) Authenticate(username, password string) error {
 	authData := map[string]string{
@@ -48,12 +87,12 @@ func (c *Client) Authenticate(username, password string) error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("authentication request failed: %w", err)
+		return requestError("authentication", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("authentication failed: status code %d", resp.StatusCode)
+		return statusError("authentication", resp)
 	}
 
 	var result struct {
@@ -68,80 +107,154 @@ func (c *Client) Authenticate(username, password string) error {
 	return nil
 }
 
-// UploadFile uploads a file to the server
-func (c *Client) UploadFile(path string, content []byte, metadata map[string]string) error {
+// ProgressFunc receives the number of bytes transferred so far and the total
+// size of the transfer
+type ProgressFunc func(transferred, total int64)
+
+// UploadFile streams size bytes from content to the server as a
+// multipart/form-data request. The metadata entries are sent as form fields
+// next to the file. The body is produced while the request is being sent, so
+// the file is never held in memory. progress may be nil. Cancelling ctx
+// stops the upload.
+func (c *Client) UploadFile(ctx context.Context, path string, content io.Reader, size int64, metadata map[string]string, progress ProgressFunc) error {
 	if c.authToken == "" {
-		return fmt.Errorf("not authenticated")
+		return ErrAuthExpired
 	}
 
-	body := new(bytes.Buffer)
-	// writer, err := http.NewRequest("POST", c.baseURL+"/api/files/upload", body)
-	// TODO: Implement multipart form upload for file
+	body, bodyWriter := io.Pipe()
+	form := multipart.NewWriter(bodyWriter)
 
-	req, err := http.NewRequest("POST", c.baseURL+"/api/files/upload", body)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/files/upload", body)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set("Content-Type", form.FormDataContentType())
 
-	resp, err := c.httpClient.Do(req)
+	go func() {
+		bodyWriter.CloseWithError(writeUploadForm(form, path, c.uploadLimiter.Reader(ctx, content), size, metadata, progress))
+	}()
+
+	resp, err := c.transferClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("upload request failed: %w", err)
+		// Unblock the form writer if the request never consumed the body
+		body.CloseWithError(err)
+		return requestError("upload", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("upload failed: status code %d", resp.StatusCode)
+		return statusError("upload", resp)
 	}
 
 	return nil
 }
 
-// DownloadFile downloads a file from the server
-func (c *Client) DownloadFile(path string) ([]byte, error) {
+// writeUploadForm writes the multipart body of an upload request
+func writeUploadForm(form *multipart.Writer, path string, content io.Reader, size int64, metadata map[string]string, progress ProgressFunc) error {
+	if err := form.WriteField("path", path); err != nil {
+		return fmt.Errorf("failed to write path field: %w", err)
+	}
+
+	for key, value := range metadata {
+		if err := form.WriteField(key, value); err != nil {
+			return fmt.Errorf("failed to write metadata field %s: %w", key, err)
+		}
+	}
+
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("failed to create file part: %w", err)
+	}
+
+	reader := &progressReader{reader: content, total: size, progress: progress}
+	if _, err := io.Copy(part, reader); err != nil {
+		return fmt.Errorf("failed to write file content: %w", err)
+	}
+
+	return form.Close()
+}
+
+// progressReader reports the number of bytes read through a ProgressFunc
+type progressReader struct {
+	reader      io.Reader
+	total       int64
+	transferred int64
+	progress    ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.transferred += int64(n)
+		if r.progress != nil {
+			r.progress(r.transferred, r.total)
+		}
+	}
+	return n, err
+}
+
+// ChecksumHeader carries the checksum of a downloaded file
+const ChecksumHeader = "X-Checksum"
+
+// ChecksumAlgorithmHeader asks for checksums computed with an algorithm,
+// and tells the one a reported checksum was computed with
+const ChecksumAlgorithmHeader = "X-Checksum-Algorithm"
+
+// DownloadFile streams a file from the server into w and returns the
+// checksum the server reported for it, with the algorithm it was computed
+// with. progress may be nil. Cancelling ctx stops the download.
+func (c *Client) DownloadFile(ctx context.Context, path string, w io.Writer, progress ProgressFunc) (string, hashing.Algorithm, error) {
 	if c.authToken == "" {
-		return nil, fmt.Errorf("not authenticated")
+		return "", "", ErrAuthExpired
 	}
 
-	req, err := http.NewRequest("GET", c.baseURL+"/api/files/download?path="+path, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/files/download?path="+url.QueryEscape(path), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", "", fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set(ChecksumAlgorithmHeader, string(c.checksumAlgorithm))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.transferClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("download request failed: %w", err)
+		return "", "", requestError("download", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("download failed: status code %d", resp.StatusCode)
+		return "", "", statusError("download", resp)
+	}
+
+	reader := &progressReader{reader: c.downloadLimiter.Reader(ctx, resp.Body), total: resp.ContentLength, progress: progress}
+	if _, err := io.Copy(w, reader); err != nil {
+		return "", "", fmt.Errorf("failed to read download: %w", err)
 	}
 
-	return io.ReadAll(resp.Body)
+	return resp.Header.Get(ChecksumHeader), hashing.Algorithm(resp.Header.Get(ChecksumAlgorithmHeader)), nil
 }
 
 // GetFileMetadata retrieves file metadata from the server
 func (c *Client) GetFileMetadata(path string) (map[string]string, error) {
 	if c.authToken == "" {
-		return nil, fmt.Errorf("not authenticated")
+		return nil, ErrAuthExpired
 	}
 
-	req, err := http.NewRequest("GET", c.baseURL+"/api/files/metadata?path="+path, nil)
+	req, err := http.NewRequest("GET", c.baseURL+"/api/files/metadata?path="+url.QueryEscape(path), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set(ChecksumAlgorithmHeader, string(c.checksumAlgorithm))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("metadata request failed: %w", err)
+		return nil, requestError("metadata", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("metadata request failed: status code %d", resp.StatusCode)
+		return nil, statusError("metadata", resp)
 	}
 
 	var result map[string]string
@@ -155,23 +268,24 @@ func (c *Client) GetFileMetadata(path string) (map[string]string, error) {
 // ListFiles lists files from the server
 func (c *Client) ListFiles(path string) ([]*models.FileInfo, error) {
 	if c.authToken == "" {
-		return nil, fmt.Errorf("not authenticated")
+		return nil, ErrAuthExpired
 	}
 
-	req, err := http.NewRequest("GET", c.baseURL+"/api/files/list?path="+path, nil)
+	req, err := http.NewRequest("GET", c.baseURL+"/api/files/list?path="+url.QueryEscape(path), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set(ChecksumAlgorithmHeader, string(c.checksumAlgorithm))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("list files request failed: %w", err)
+		return nil, requestError("list files", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("list files request failed: status code %d", resp.StatusCode)
+		return nil, statusError("list files", resp)
 	}
 
 	var result []*models.FileInfo
@@ -185,23 +299,84 @@ func (c *Client) ListFiles(path string) ([]*models.FileInfo, error) {
 // DeleteFile deletes a file from the server
 func (c *Client) DeleteFile(path string) error {
 	if c.authToken == "" {
-		return fmt.Errorf("not authenticated")
+		return ErrAuthExpired
+	}
+
+	req, err := http.NewRequest("DELETE", c.baseURL+"/api/files?path="+url.QueryEscape(path), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError("delete", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError("delete", resp)
+	}
+
+	return nil
+}
+
+// CreateDirectory creates a directory on the server. Creating a directory
+// that already exists is not an error.
+func (c *Client) CreateDirectory(path string) error {
+	if c.authToken == "" {
+		return ErrAuthExpired
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/files/directory?path="+url.QueryEscape(path), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return requestError("create directory", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError("create directory", resp)
+	}
+
+	return nil
+}
+
+// MoveFile moves or renames a file or directory on the server. The server
+// keeps the version history of the file.
+func (c *Client) MoveFile(from, to string) error {
+	if c.authToken == "" {
+		return ErrAuthExpired
 	}
 
-	req, err := http.NewRequest("DELETE", c.baseURL+"/api/files?path="+path, nil)
+	data, err := json.Marshal(map[string]string{
+		"from": from,
+		"to":   to,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal move request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/files/move", bytes.NewBuffer(data))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("delete request failed: %w", err)
+		return requestError("move", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("delete failed: status code %d", resp.StatusCode)
+		return statusError("move", resp)
 	}
 
 	return nil
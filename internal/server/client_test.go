@@ -0,0 +1,275 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"homecloud/internal/chunking"
+	"homecloud/internal/delta"
+	"homecloud/internal/hashing"
+	"homecloud/internal/server"
+	"homecloud/internal/server/testserver"
+)
+
+// newTestClient starts a test server storing its files in a temporary
+// directory and returns an authenticated client for it, with the directory
+func newTestClient(t *testing.T) (*server.Client, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	srv := httptest.NewServer(testserver.New(root))
+	t.Cleanup(srv.Close)
+
+	return authenticate(t, srv.URL), root
+}
+
+// authenticate returns a new client logged in to the server at baseURL
+func authenticate(t *testing.T, baseURL string) *server.Client {
+	t.Helper()
+
+	client := server.NewClient(baseURL)
+	if err := client.Authenticate("user", "password"); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	return client
+}
+
+// checksum returns the checksum of data computed with the default algorithm
+func checksum(t *testing.T, data []byte) string {
+	t.Helper()
+
+	h, err := hashing.DefaultAlgorithm.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// randomBytes returns n bytes of deterministic noise
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// upload sends content to path with its checksum as metadata
+func upload(t *testing.T, client *server.Client, path string, content []byte) {
+	t.Helper()
+
+	metadata := map[string]string{"checksum": checksum(t, content), "version": "1"}
+	if err := client.UploadFile(context.Background(), path, bytes.NewReader(content), int64(len(content)), metadata, nil); err != nil {
+		t.Fatalf("UploadFile(%q) error = %v", path, err)
+	}
+}
+
+// download fetches path and checks the checksum reported with it
+func download(t *testing.T, client *server.Client, path string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	reported, algorithm, err := client.DownloadFile(context.Background(), path, &buf, nil)
+	if err != nil {
+		t.Fatalf("DownloadFile(%q) error = %v", path, err)
+	}
+	if want := checksum(t, buf.Bytes()); reported != want || algorithm != hashing.DefaultAlgorithm {
+		t.Errorf("DownloadFile(%q) reported %s checksum %s, want %s %s", path, algorithm, reported, hashing.DefaultAlgorithm, want)
+	}
+	return buf.Bytes()
+}
+
+func TestClientFiles(t *testing.T) {
+	client, root := newTestClient(t)
+
+	// Query characters in the name must survive every request
+	const path = "dir/a b&c#d+e.txt"
+	content := []byte("hello")
+	if err := client.CreateDirectory("dir"); err != nil {
+		t.Fatalf("CreateDirectory() error = %v", err)
+	}
+	upload(t, client, path, content)
+
+	if got := download(t, client, path); !bytes.Equal(got, content) {
+		t.Errorf("DownloadFile() = %q, want %q", got, content)
+	}
+
+	metadata, err := client.GetFileMetadata(path)
+	if err != nil {
+		t.Fatalf("GetFileMetadata() error = %v", err)
+	}
+	if metadata["version"] != "1" || metadata["size"] != strconv.Itoa(len(content)) {
+		t.Errorf("GetFileMetadata() = %v, want version 1 and size %d", metadata, len(content))
+	}
+
+	files, err := client.ListFiles("dir")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if len(files) != 1 || files[0].Path != path {
+		t.Errorf("ListFiles() = %v, want %s only", files, path)
+	}
+
+	if err := client.MoveFile(path, "moved.txt"); err != nil {
+		t.Fatalf("MoveFile() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "moved.txt")); err != nil {
+		t.Errorf("moved file is not on the server: %v", err)
+	}
+
+	if err := client.DeleteFile("moved.txt"); err != nil {
+		t.Fatalf("DeleteFile() error = %v", err)
+	}
+	if _, err := client.GetFileMetadata("moved.txt"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("GetFileMetadata() of a deleted file error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientNotAuthenticated(t *testing.T) {
+	client := server.NewClient("http://127.0.0.1:0")
+	if _, err := client.ListFiles(""); !errors.Is(err, server.ErrAuthExpired) {
+		t.Errorf("ListFiles() without a token error = %v, want ErrAuthExpired", err)
+	}
+}
+
+func TestClientCancelledTransfer(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.UploadFile(ctx, "a", bytes.NewReader([]byte("data")), 4, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("UploadFile() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestClientUploadSession(t *testing.T) {
+	root := t.TempDir()
+	srv := httptest.NewServer(testserver.New(root))
+	defer srv.Close()
+	client := authenticate(t, srv.URL)
+
+	content := randomBytes(1, 3*1024)
+	size := int64(len(content))
+	sessionID, err := client.CreateUploadSession("big", size, map[string]string{"version": "1"})
+	if err != nil {
+		t.Fatalf("CreateUploadSession() error = %v", err)
+	}
+
+	offset, err := client.UploadChunk(context.Background(), sessionID, 0, bytes.NewReader(content[:1024]), 1024)
+	if err != nil || offset != 1024 {
+		t.Fatalf("UploadChunk() = %d, %v, want 1024", offset, err)
+	}
+
+	// A client starting over learns where to continue from the server
+	resumed := authenticate(t, srv.URL)
+	if offset, err = resumed.GetUploadOffset(sessionID); err != nil || offset != 1024 {
+		t.Fatalf("GetUploadOffset() = %d, %v, want 1024", offset, err)
+	}
+	if _, err := resumed.UploadChunk(context.Background(), sessionID, 0, bytes.NewReader(content), size); err == nil {
+		t.Errorf("UploadChunk() at an offset already confirmed succeeded")
+	}
+	if offset, err = resumed.UploadChunk(context.Background(), sessionID, offset, bytes.NewReader(content[offset:]), size-offset); err != nil || offset != size {
+		t.Fatalf("UploadChunk() = %d, %v, want %d", offset, err, size)
+	}
+	if err := resumed.CompleteUploadSession(sessionID); err != nil {
+		t.Fatalf("CompleteUploadSession() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(root, "big"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("server has %d bytes, %v, want the %d uploaded", len(got), err, size)
+	}
+}
+
+func TestClientDelta(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	base := randomBytes(2, 256<<10)
+	upload(t, client, "file", base)
+
+	edited := bytes.Clone(base)
+	copy(edited[100<<10:], "an edit")
+
+	sig, baseChecksum, err := client.GetSignature("file", delta.BlockSize(int64(len(edited))))
+	if err != nil {
+		t.Fatalf("GetSignature() error = %v", err)
+	}
+	metadata := map[string]string{"checksum": checksum(t, edited)}
+	if err := client.UploadDelta(context.Background(), "file", sig, baseChecksum, bytes.NewReader(edited), int64(len(edited)), metadata, nil); err != nil {
+		t.Fatalf("UploadDelta() error = %v", err)
+	}
+	if got := download(t, client, "file"); !bytes.Equal(got, edited) {
+		t.Fatalf("server has a different version after UploadDelta()")
+	}
+
+	// A delta against a version the server no longer has is refused
+	err = client.UploadDelta(context.Background(), "file", sig, baseChecksum, bytes.NewReader(base), int64(len(base)), nil, nil)
+	if !errors.Is(err, server.ErrConflict) {
+		t.Errorf("UploadDelta() against a stale version error = %v, want ErrConflict", err)
+	}
+
+	// And back, rebuilding the server's version from the local one
+	localSig, err := delta.NewSignature(bytes.NewReader(base), delta.BlockSize(int64(len(base))))
+	if err != nil {
+		t.Fatalf("NewSignature() error = %v", err)
+	}
+	var rebuilt bytes.Buffer
+	reported, _, err := client.DownloadDelta(context.Background(), "file", localSig, bytes.NewReader(base), &rebuilt, nil)
+	if err != nil {
+		t.Fatalf("DownloadDelta() error = %v", err)
+	}
+	if !bytes.Equal(rebuilt.Bytes(), edited) || reported != metadata["checksum"] {
+		t.Errorf("DownloadDelta() rebuilt a different version")
+	}
+}
+
+func TestClientChunks(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	content := randomBytes(3, 1<<20)
+	chunks, err := chunking.Manifest(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	hashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		hashes[i] = chunk.Hash
+	}
+
+	missing, err := client.MissingChunks(hashes)
+	if err != nil || len(missing) != len(chunks) {
+		t.Fatalf("MissingChunks() = %d chunks, %v, want all %d", len(missing), err, len(chunks))
+	}
+
+	var offset int64
+	for _, chunk := range chunks {
+		data := content[offset : offset+chunk.Size]
+		offset += chunk.Size
+		if err := client.PutChunk(context.Background(), chunk.Hash, data); err != nil {
+			t.Fatalf("PutChunk() error = %v", err)
+		}
+	}
+	if err := client.PutChunk(context.Background(), chunks[0].Hash, []byte("other data")); err == nil {
+		t.Errorf("PutChunk() with data not matching the hash succeeded")
+	}
+
+	if missing, err = client.MissingChunks(hashes); err != nil || len(missing) != 0 {
+		t.Errorf("MissingChunks() after uploading = %v, %v, want none", missing, err)
+	}
+
+	metadata := map[string]string{"checksum": checksum(t, content)}
+	if err := client.CommitManifest("file", chunks, metadata); err != nil {
+		t.Fatalf("CommitManifest() error = %v", err)
+	}
+	if got := download(t, client, "file"); !bytes.Equal(got, content) {
+		t.Errorf("server assembled a different file from the manifest")
+	}
+}
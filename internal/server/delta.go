@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"homecloud/internal/delta"
+	"homecloud/internal/hashing"
+)
+
+// GetSignature returns the block signature of the server's version of path,
+// along with the checksum of that version
+func (c *Client) GetSignature(path string, blockSize int) (*delta.Signature, string, error) {
+	if c.authToken == "" {
+		return nil, "", ErrAuthExpired
+	}
+
+	query := url.Values{"path": {path}, "blockSize": {strconv.Itoa(blockSize)}}
+	req, err := http.NewRequest("GET", c.baseURL+"/api/files/signature?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set(ChecksumAlgorithmHeader, string(c.checksumAlgorithm))
+
+	resp, err := c.transferClient.Do(req)
+	if err != nil {
+		return nil, "", requestError("signature", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", statusError("signature", resp)
+	}
+
+	sig, err := delta.ReadSignature(c.downloadLimiter.Reader(req.Context(), resp.Body))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sig, resp.Header.Get(ChecksumHeader), nil
+}
+
+// UploadDelta uploads content as the changes from the server's version of
+// path that sig was computed from. baseChecksum is the checksum of that
+// version, the server refuses the delta with ErrConflict if its version
+// changed meanwhile. Progress is reported on content, not on the delta.
+// Cancelling ctx stops the upload.
+func (c *Client) UploadDelta(ctx context.Context, path string, sig *delta.Signature, baseChecksum string, content io.Reader, size int64, metadata map[string]string, progress ProgressFunc) error {
+	if c.authToken == "" {
+		return ErrAuthExpired
+	}
+
+	body, bodyWriter := io.Pipe()
+	form := multipart.NewWriter(bodyWriter)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/files/upload/delta", body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	fields := maps.Clone(metadata)
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	fields["baseChecksum"] = baseChecksum
+
+	changes, changesWriter := io.Pipe()
+	go func() {
+		reader := &progressReader{reader: content, total: size, progress: progress}
+		changesWriter.CloseWithError(delta.Write(changesWriter, sig, reader))
+	}()
+
+	go func() {
+		err := writeUploadForm(form, path, c.uploadLimiter.Reader(ctx, changes), -1, fields, nil)
+		// Stop computing the delta if the form could not be sent
+		changes.CloseWithError(err)
+		bodyWriter.CloseWithError(err)
+	}()
+
+	resp, err := c.transferClient.Do(req)
+	if err != nil {
+		body.CloseWithError(err)
+		return requestError("delta upload", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError("delta upload", resp)
+	}
+
+	return nil
+}
+
+// DownloadDelta fetches the server's version of path as the changes from
+// base, the local version sig was computed from, and writes the rebuilt file
+// to w. It returns the checksum and algorithm the server reported for its
+// version. Progress is reported on the delta received. Cancelling ctx
+// stops the download.
+func (c *Client) DownloadDelta(ctx context.Context, path string, sig *delta.Signature, base io.ReaderAt, w io.Writer, progress ProgressFunc) (string, hashing.Algorithm, error) {
+	if c.authToken == "" {
+		return "", "", ErrAuthExpired
+	}
+
+	var signature bytes.Buffer
+	if _, err := sig.WriteTo(&signature); err != nil {
+		return "", "", fmt.Errorf("failed to encode signature: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/files/download/delta?path="+url.QueryEscape(path), c.uploadLimiter.Reader(ctx, &signature))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(ChecksumAlgorithmHeader, string(c.checksumAlgorithm))
+
+	resp, err := c.transferClient.Do(req)
+	if err != nil {
+		return "", "", requestError("delta download", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", statusError("delta download", resp)
+	}
+
+	reader := &progressReader{reader: c.downloadLimiter.Reader(ctx, resp.Body), total: resp.ContentLength, progress: progress}
+	if err := delta.Apply(w, base, reader); err != nil {
+		return "", "", fmt.Errorf("failed to apply delta: %w", err)
+	}
+
+	return resp.Header.Get(ChecksumHeader), hashing.Algorithm(resp.Header.Get(ChecksumAlgorithmHeader)), nil
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The kinds of errors returned by the client. Failed requests wrap one of
+// them, test with errors.Is or get it with Classify.
+var (
+	// ErrAuthExpired is returned when the client has no token or the server
+	// no longer accepts it
+	ErrAuthExpired = errors.New("not authenticated")
+	// ErrNotFound is returned when the requested path does not exist on the
+	// server
+	ErrNotFound = errors.New("not found on server")
+	// ErrConflict is returned when the server refuses a change because the
+	// file changed there in the meantime
+	ErrConflict = errors.New("conflicting change on server")
+	// ErrQuotaExceeded is returned when the server has no space left for
+	// the account
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrRateLimited is returned when the server asks to slow down
+	ErrRateLimited = errors.New("rate limited by server")
+	// ErrTransient is returned for network failures and server errors that
+	// are likely to go away by themselves
+	ErrTransient = errors.New("temporary failure")
+	// ErrPermanent is returned for requests the server rejects and will keep
+	// rejecting
+	ErrPermanent = errors.New("request rejected")
+)
+
+// maxErrorMessage bounds how much of an error response is kept as message
+const maxErrorMessage = 256
+
+// RequestError is a request that failed, either without a response or with
+// an error status from the server
+type RequestError struct {
+	// Op names the request, such as "upload" or "list files"
+	Op string
+	// StatusCode is zero when no response was received
+	StatusCode int
+	// Message is the text of the error response, if any
+	Message string
+	// RetryAfter is how long the server asked to wait before trying again
+	RetryAfter time.Duration
+	// Kind is one of the error kinds of this package
+	Kind error
+	// Err is what made the request fail without a response
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s request failed: %v", e.Op, e.Err)
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("%s request failed: status code %d: %s", e.Op, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s request failed: status code %d", e.Op, e.StatusCode)
+}
+
+func (e *RequestError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// requestError wraps the error of a request that got no response. Those
+// are network failures, worth trying again.
+func requestError(op string, err error) error {
+	return &RequestError{Op: op, Kind: ErrTransient, Err: err}
+}
+
+// statusError turns an error response into a RequestError classified by
+// its status code
+func statusError(op string, resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorMessage))
+
+	return &RequestError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(message)),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Kind:       statusKind(resp.StatusCode),
+	}
+}
+
+// statusKind classifies an error status code
+func statusKind(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return ErrAuthExpired
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		return ErrNotFound
+	case statusCode == http.StatusConflict || statusCode == http.StatusPreconditionFailed:
+		return ErrConflict
+	case statusCode == http.StatusInsufficientStorage:
+		return ErrQuotaExceeded
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return ErrTransient
+	default:
+		return ErrPermanent
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, given either in seconds or
+// as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// Classify returns the kind of err, one of the error kinds of this package.
+// Errors that did not come from a request are transient when they look like
+// network failures and permanent otherwise.
+func Classify(err error) error {
+	for _, kind := range []error{ErrAuthExpired, ErrNotFound, ErrConflict, ErrQuotaExceeded, ErrRateLimited, ErrTransient, ErrPermanent} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return ErrTransient
+	}
+	return ErrPermanent
+}
+
+// RetryAfter returns how long the server asked to wait before trying again,
+// zero if it did not say
+func RetryAfter(err error) time.Duration {
+	var requestErr *RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStatusKind(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       error
+	}{
+		{http.StatusUnauthorized, ErrAuthExpired},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusGone, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusPreconditionFailed, ErrConflict},
+		{http.StatusInsufficientStorage, ErrQuotaExceeded},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusRequestTimeout, ErrTransient},
+		{http.StatusInternalServerError, ErrTransient},
+		{http.StatusBadGateway, ErrTransient},
+		{http.StatusServiceUnavailable, ErrTransient},
+		{http.StatusBadRequest, ErrPermanent},
+		{http.StatusForbidden, ErrPermanent},
+		{http.StatusRequestEntityTooLarge, ErrPermanent},
+	}
+
+	for _, test := range tests {
+		if got := statusKind(test.statusCode); got != test.want {
+			t.Errorf("statusKind(%d) = %v, want %v", test.statusCode, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		min, max time.Duration
+	}{
+		{"missing", "", 0, 0},
+		{"seconds", "120", 2 * time.Minute, 2 * time.Minute},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"garbage", "soon", 0, 0},
+		// HTTP dates have a resolution of a second
+		{"date", time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 88 * time.Second, 90 * time.Second},
+		{"date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseRetryAfter(test.value); got < test.min || got > test.max {
+				t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", test.value, got, test.min, test.max)
+			}
+		})
+	}
+}
+
+// response returns the error of a response with statusCode, body and a
+// Retry-After header unless empty
+func response(statusCode int, body, retryAfter string) error {
+	recorder := httptest.NewRecorder()
+	if retryAfter != "" {
+		recorder.Header().Set("Retry-After", retryAfter)
+	}
+	recorder.WriteHeader(statusCode)
+	io.WriteString(recorder, body)
+	return statusError("upload", recorder.Result())
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"error status", response(http.StatusConflict, "", ""), ErrConflict},
+		{"wrapped error status", fmt.Errorf("failed to upload file: %w", response(http.StatusNotFound, "", "")), ErrNotFound},
+		{"no response", requestError("upload", errors.New("connection lost")), ErrTransient},
+		{"kind", ErrQuotaExceeded, ErrQuotaExceeded},
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, ErrTransient},
+		{"connection reset", fmt.Errorf("failed to read: %w", os.NewSyscallError("read", syscall.ECONNRESET)), ErrTransient},
+		{"connection refused", syscall.ECONNREFUSED, ErrTransient},
+		{"broken pipe", syscall.EPIPE, ErrTransient},
+		{"truncated body", fmt.Errorf("failed to download: %w", io.ErrUnexpectedEOF), ErrTransient},
+		{"anything else", errors.New("failed to open file"), ErrPermanent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Classify(test.err); got != test.want {
+				t.Errorf("Classify(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	err := response(http.StatusTooManyRequests, " slow down \n", "30")
+
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("errors.Is(%v, ErrRateLimited) = false, want true", err)
+	}
+	if got := RetryAfter(fmt.Errorf("failed to upload file: %w", err)); got != 30*time.Second {
+		t.Errorf("RetryAfter() = %v, want 30s", got)
+	}
+	if want := "upload request failed: status code 429: slow down"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	cause := errors.New("connection lost")
+	err = requestError("list files", cause)
+	if !errors.Is(err, cause) || RetryAfter(err) != 0 {
+		t.Errorf("requestError() = %v, want it to wrap its cause without a retry delay", err)
+	}
+}
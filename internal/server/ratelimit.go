@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimitChunk is the largest read a rate limited reader makes at once,
+// so slow limits still move data steadily
+const rateLimitChunk = 32 * 1024
+
+// rateLimitPoll bounds how long a waiting transfer sleeps before looking at
+// the limit again, a changed limit applies within that time
+const rateLimitPoll = 250 * time.Millisecond
+
+// RateLimiter is a token bucket shared by every transfer going through it,
+// so the limit holds for the sum of concurrent transfers. The bucket holds
+// up to one second worth of tokens, a byte costs one token.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter letting bytesPerSecond through, zero
+// meaning unlimited
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// SetRate changes the limit, transfers in progress follow it right away.
+// The balance of the bucket carries over, debt included, so setting the
+// limit again does not let a burst through.
+func (l *RateLimiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bytesPerSecond = max(bytesPerSecond, 0)
+	if bytesPerSecond == l.rate {
+		return
+	}
+
+	if l.rate == 0 {
+		// Nothing was counted while unlimited
+		l.tokens = 0
+		l.last = time.Now()
+	} else {
+		// Tokens earned so far are at the old rate
+		l.refill()
+	}
+	l.rate = bytesPerSecond
+	l.tokens = min(l.tokens, float64(l.rate))
+}
+
+// Rate returns the limit in bytes per second, zero meaning unlimited
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// wait takes n tokens from the bucket and blocks until they are paid for or
+// ctx is cancelled. The tokens are taken at once, transfers waiting together
+// queue up behind each other's debt.
+func (l *RateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.refill()
+	l.tokens -= float64(n)
+	l.mu.Unlock()
+
+	for {
+		l.mu.Lock()
+		if l.rate == 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		l.refill()
+		if l.tokens >= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(min(delay, rateLimitPoll))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// refill adds the tokens earned since the last refill. The caller holds
+// the lock.
+func (l *RateLimiter) refill() {
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), float64(l.rate))
+	l.last = now
+}
+
+// Reader returns a reader whose reads from r go through the limiter. Reads
+// fail once ctx is cancelled instead of waiting for their turn.
+func (l *RateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &limitedReader{ctx: ctx, reader: r, limiter: l}
+}
+
+// limitedReader paces the reads of a reader with a RateLimiter
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *RateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readAll reads n bytes through the limiter and returns how long it took
+func readAll(t *testing.T, l *RateLimiter, n int) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+	data, err := io.ReadAll(l.Reader(context.Background(), bytes.NewReader(make([]byte, n))))
+	if err != nil || len(data) != n {
+		t.Errorf("read %d bytes, %v, want %d", len(data), err, n)
+	}
+	return time.Since(start)
+}
+
+// balance returns the tokens left in the bucket
+func balance(l *RateLimiter) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens
+}
+
+func TestRateLimiterRate(t *testing.T) {
+	l := NewRateLimiter(1 << 20)
+
+	// Nothing saved up yet, half a second worth takes half a second
+	if took := readAll(t, l, 512<<10); took < 400*time.Millisecond || took > time.Second {
+		t.Errorf("reading half a second worth took %v", took)
+	}
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	l := NewRateLimiter(1 << 20)
+
+	// Two transfers together take as long as one of their combined size
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readAll(t, l, 256<<10)
+		}()
+	}
+	wg.Wait()
+	if took := time.Since(start); took < 400*time.Millisecond || took > time.Second {
+		t.Errorf("two transfers of a quarter second worth took %v", took)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	const rate = 1 << 20
+	l := NewRateLimiter(rate)
+
+	// Idle for long enough, the bucket is full but holds one second worth
+	l.mu.Lock()
+	l.last = time.Now().Add(-5 * time.Second)
+	l.mu.Unlock()
+
+	if took := readAll(t, l, rate); took > 200*time.Millisecond {
+		t.Errorf("reading a full bucket took %v, want no wait", took)
+	}
+	if took := readAll(t, l, rate/4); took < 200*time.Millisecond {
+		t.Errorf("reading past a full bucket took %v, want a quarter second", took)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiter(0)
+	if took := readAll(t, l, 4<<20); took > time.Second {
+		t.Errorf("reading without a limit took %v", took)
+	}
+	if l.Rate() != 0 {
+		t.Errorf("Rate() = %d, want 0", l.Rate())
+	}
+
+	// Negative limits mean no limit either
+	l.SetRate(-1)
+	if l.Rate() != 0 {
+		t.Errorf("Rate() after SetRate(-1) = %d, want 0", l.Rate())
+	}
+}
+
+func TestRateLimiterSetRate(t *testing.T) {
+	l := NewRateLimiter(1000)
+	if balance(l) != 0 {
+		t.Errorf("new limiter starts with %v tokens, want 0", balance(l))
+	}
+
+	// A debt carries over, setting the limit again lets nothing through
+	l.mu.Lock()
+	l.tokens = -500
+	l.mu.Unlock()
+	l.SetRate(1000)
+	if tokens := balance(l); tokens > -400 {
+		t.Errorf("balance after setting the same limit = %v, want the debt of 500 kept", tokens)
+	}
+	l.SetRate(2000)
+	l.SetRate(1000)
+	if tokens := balance(l); tokens > -400 {
+		t.Errorf("balance after changing the limit back and forth = %v, want the debt of 500 kept", tokens)
+	}
+
+	// Saved up tokens never exceed a second worth at the new limit
+	l.mu.Lock()
+	l.tokens = 1000
+	l.mu.Unlock()
+	l.SetRate(100)
+	if tokens := balance(l); tokens > 100 {
+		t.Errorf("balance after lowering the limit = %v, want at most 100", tokens)
+	}
+
+	// Going through unlimited starts over without debt or savings
+	l.SetRate(0)
+	l.SetRate(1000)
+	if tokens := balance(l); tokens != 0 {
+		t.Errorf("balance after being unlimited = %v, want 0", tokens)
+	}
+}
+
+func TestRateLimiterSetRateDuringTransfer(t *testing.T) {
+	l := NewRateLimiter(1024)
+
+	// A transfer stuck behind a slow limit speeds up as soon as it is lifted
+	done := make(chan time.Duration)
+	go func() { done <- readAll(t, l, 64<<10) }()
+	time.Sleep(100 * time.Millisecond)
+	l.SetRate(0)
+
+	select {
+	case took := <-done:
+		if took > time.Second {
+			t.Errorf("transfer took %v after lifting the limit", took)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not finish after lifting the limit")
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := io.ReadAll(l.Reader(ctx, bytes.NewReader(make([]byte, 64<<10))))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("read error = %v, want context.Canceled", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("cancelled read took %v", took)
+	}
+}
@@ -0,0 +1,911 @@
+// Package testserver implements the parts of the HomeCloud server API used by
+// the desktop client. Files are stored under a local directory, which makes it
+// suitable for development and tests:
+//
+//	srv := httptest.NewServer(testserver.New(t.TempDir()))
+package testserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"homecloud/internal/chunking"
+	"homecloud/internal/delta"
+	"homecloud/internal/hashing"
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+)
+
+// Token is the bearer token handed out by the login endpoint
+const Token = "test-token"
+
+// Server is an http.Handler serving the HomeCloud API from a directory
+type Server struct {
+	root     string
+	mux      *http.ServeMux
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+	metadata map[string]map[string]string
+}
+
+// uploadSession is a resumable upload that has not been completed yet
+type uploadSession struct {
+	id       string
+	path     string
+	size     int64
+	offset   int64
+	metadata map[string]string
+}
+
+// New creates a test server storing its files in root
+func New(root string) *Server {
+	s := &Server{
+		root:     root,
+		mux:      http.NewServeMux(),
+		sessions: make(map[string]*uploadSession),
+		metadata: make(map[string]map[string]string),
+	}
+
+	s.mux.HandleFunc("POST /api/auth/login", s.handleLogin)
+	s.mux.HandleFunc("GET /api/files/metadata", s.authorized(s.handleMetadata))
+	s.mux.HandleFunc("GET /api/files/download", s.authorized(s.handleDownload))
+	s.mux.HandleFunc("GET /api/files/list", s.authorized(s.handleList))
+	s.mux.HandleFunc("DELETE /api/files", s.authorized(s.handleDelete))
+	s.mux.HandleFunc("POST /api/files/upload", s.authorized(s.handleUpload))
+	s.mux.HandleFunc("GET /api/files/signature", s.authorized(s.handleSignature))
+	s.mux.HandleFunc("POST /api/files/upload/delta", s.authorized(s.handleUploadDelta))
+	s.mux.HandleFunc("POST /api/files/download/delta", s.authorized(s.handleDownloadDelta))
+	s.mux.HandleFunc("POST /api/files/manifest", s.authorized(s.handleCommitManifest))
+	s.mux.HandleFunc("POST /api/files/directory", s.authorized(s.handleCreateDirectory))
+	s.mux.HandleFunc("POST /api/files/move", s.authorized(s.handleMove))
+	s.mux.HandleFunc("POST /api/uploads", s.authorized(s.handleCreateUpload))
+	s.mux.HandleFunc("GET /api/uploads/{id}", s.authorized(s.handleUploadStatus))
+	s.mux.HandleFunc("PUT /api/uploads/{id}", s.authorized(s.handleUploadChunk))
+	s.mux.HandleFunc("POST /api/uploads/{id}/complete", s.authorized(s.handleCompleteUpload))
+	s.mux.HandleFunc("POST /api/chunks/missing", s.authorized(s.handleMissingChunks))
+	s.mux.HandleFunc("PUT /api/chunks/{hash}", s.authorized(s.handlePutChunk))
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized rejects requests that do not carry the test token
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+Token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"token": Token})
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	remotePath, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stat, err := os.Stat(s.localPath(remotePath))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if stat.IsDir() {
+		writeJSON(w, map[string]string{"isDirectory": "true"})
+		return
+	}
+
+	algorithm, err := hashing.ParseAlgorithm(r.Header.Get(server.ChecksumAlgorithmHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The checksum always reflects the file on disk, so tests can change
+	// files behind the server's back
+	checksum, err := hashing.File(s.localPath(remotePath), algorithm)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	metadata := map[string]string{}
+	s.mu.Lock()
+	for key, value := range s.metadata[remotePath] {
+		metadata[key] = value
+	}
+	s.mu.Unlock()
+	metadata["checksum"] = checksum
+	metadata["checksumAlgorithm"] = string(algorithm)
+	metadata["size"] = strconv.FormatInt(stat.Size(), 10)
+
+	writeJSON(w, metadata)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		// The client sends every field before the file
+		remotePath, err := cleanPath(fields["path"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.writeFile(remotePath, part); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		delete(fields, "path")
+		s.mu.Lock()
+		s.metadata[remotePath] = fields
+		s.mu.Unlock()
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeFile stores content at remotePath through a temporary file, so a
+// failed upload never leaves a partial file behind
+func (s *Server) writeFile(remotePath string, content io.Reader) error {
+	if err := os.MkdirAll(s.uploadsDir(), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(s.uploadsDir(), "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, content); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	target := s.localPath(remotePath)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), target)
+}
+
+func (s *Server) handleCreateDirectory(w http.ResponseWriter, r *http.Request) {
+	remotePath, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := os.MkdirAll(s.localPath(remotePath), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, err := cleanPath(request.From)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := cleanPath(request.To)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := os.Stat(s.localPath(from)); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.localPath(to)), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(s.localPath(from), s.localPath(to)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Metadata, and with it the version history, follows the files
+	s.mu.Lock()
+	moved := make(map[string]map[string]string)
+	for remotePath, metadata := range s.metadata {
+		if remotePath == from || strings.HasPrefix(remotePath, from+"/") {
+			moved[to+strings.TrimPrefix(remotePath, from)] = metadata
+			delete(s.metadata, remotePath)
+		}
+	}
+	for remotePath, metadata := range moved {
+		s.metadata[remotePath] = metadata
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	remotePath, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := os.RemoveAll(s.localPath(remotePath)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.metadata, remotePath)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	remotePath, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	algorithm, err := hashing.ParseAlgorithm(r.Header.Get(server.ChecksumAlgorithmHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	localPath := s.localPath(remotePath)
+	checksum, err := hashing.File(localPath, algorithm)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set(server.ChecksumHeader, checksum)
+	w.Header().Set(server.ChecksumAlgorithmHeader, string(algorithm))
+	http.ServeFile(w, r, localPath)
+}
+
+func (s *Server) handleSignature(w http.ResponseWriter, r *http.Request) {
+	remotePath, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	algorithm, err := hashing.ParseAlgorithm(r.Header.Get(server.ChecksumAlgorithmHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	blockSize, err := strconv.Atoi(r.URL.Query().Get("blockSize"))
+	if err != nil {
+		http.Error(w, "invalid block size", http.StatusBadRequest)
+		return
+	}
+
+	localPath := s.localPath(remotePath)
+	checksum, err := hashing.File(localPath, algorithm)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	sig, err := delta.NewSignature(file, blockSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set(server.ChecksumHeader, checksum)
+	w.Header().Set(server.ChecksumAlgorithmHeader, string(algorithm))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	sig.WriteTo(w)
+}
+
+func (s *Server) handleUploadDelta(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		remotePath, err := cleanPath(fields["path"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		algorithm, err := hashing.ParseAlgorithm(fields["checksumAlgorithm"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The delta only applies to the version it was computed against
+		localPath := s.localPath(remotePath)
+		baseChecksum, err := hashing.File(localPath, algorithm)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if baseChecksum != fields["baseChecksum"] {
+			http.Error(w, "file changed since its signature was taken", http.StatusConflict)
+			return
+		}
+
+		base, err := os.Open(localPath)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer base.Close()
+
+		rebuilt, rebuiltWriter := io.Pipe()
+		go func() {
+			digest, _ := algorithm.New()
+			if err := delta.Apply(io.MultiWriter(rebuiltWriter, digest), base, part); err != nil {
+				rebuiltWriter.CloseWithError(err)
+				return
+			}
+			// A mismatch fails the write, the previous version is kept
+			if checksum := hex.EncodeToString(digest.Sum(nil)); fields["checksum"] != "" && checksum != fields["checksum"] {
+				rebuiltWriter.CloseWithError(fmt.Errorf("checksum mismatch: expected %s, got %s", fields["checksum"], checksum))
+				return
+			}
+			rebuiltWriter.Close()
+		}()
+
+		err = s.writeFile(remotePath, rebuilt)
+		rebuilt.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		delete(fields, "path")
+		delete(fields, "baseChecksum")
+		s.mu.Lock()
+		s.metadata[remotePath] = fields
+		s.mu.Unlock()
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleDownloadDelta(w http.ResponseWriter, r *http.Request) {
+	remotePath, err := cleanPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	algorithm, err := hashing.ParseAlgorithm(r.Header.Get(server.ChecksumAlgorithmHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sig, err := delta.ReadSignature(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	localPath := s.localPath(remotePath)
+	checksum, err := hashing.File(localPath, algorithm)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set(server.ChecksumHeader, checksum)
+	w.Header().Set(server.ChecksumAlgorithmHeader, string(algorithm))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	delta.Write(w, sig, file)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	algorithm, err := hashing.ParseAlgorithm(r.Header.Get(server.ChecksumAlgorithmHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dir := r.URL.Query().Get("path")
+	localDir := s.root
+	if dir != "" {
+		cleaned, err := cleanPath(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dir = cleaned
+		localDir = s.localPath(dir)
+	}
+
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	result := make([]*models.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		// Upload sessions in progress are not part of the tree
+		if dir == "" && entry.Name() == filepath.Base(s.uploadsDir()) {
+			continue
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		info := &models.FileInfo{
+			Path:         path.Join(dir, entry.Name()),
+			Status:       models.StatusSynced,
+			LastModified: stat.ModTime(),
+			IsDirectory:  entry.IsDir(),
+			Version:      1,
+		}
+		if !entry.IsDir() {
+			info.Size = stat.Size()
+			info.Checksum, _ = hashing.File(filepath.Join(localDir, entry.Name()), algorithm)
+			info.ChecksumAlgorithm = string(algorithm)
+			info.Version = s.version(info.Path)
+		}
+
+		result = append(result, info)
+	}
+
+	writeJSON(w, result)
+}
+
+func (s *Server) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Path     string            `json:"path"`
+		Size     int64             `json:"size"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	remotePath, err := cleanPath(request.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.MkdirAll(s.uploadsDir(), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.WriteFile(s.sessionFile(id), nil, 0644); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session := &uploadSession{
+		id:       id,
+		path:     remotePath,
+		size:     request.Size,
+		metadata: request.Metadata,
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+
+	writeSession(w, session)
+}
+
+func (s *Server) handleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	session := s.session(r.PathValue("id"))
+	if session == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeSession(w, session)
+}
+
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	session := s.session(r.PathValue("id"))
+	if session == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Chunks must be sent in order, the client resumes from the offset
+	// returned by the status endpoint
+	if offset != session.offset {
+		http.Error(w, fmt.Sprintf("expected offset %d", session.offset), http.StatusConflict)
+		return
+	}
+
+	file, err := os.OpenFile(s.sessionFile(session.id), os.O_WRONLY, 0644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	written, err := io.Copy(io.NewOffsetWriter(file, offset), io.LimitReader(r.Body, session.size-offset))
+	session.offset += written
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeSession(w, session)
+}
+
+func (s *Server) handleCompleteUpload(w http.ResponseWriter, r *http.Request) {
+	session := s.session(r.PathValue("id"))
+	if session == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session.offset != session.size {
+		http.Error(w, fmt.Sprintf("upload incomplete: %d of %d bytes", session.offset, session.size), http.StatusConflict)
+		return
+	}
+
+	target := s.localPath(session.path)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(s.sessionFile(session.id), target); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.metadata[session.path] = session.metadata
+	delete(s.sessions, session.id)
+
+	writeSession(w, session)
+}
+
+// handleMissingChunks only knows the chunks uploaded through the chunk
+// endpoints, files uploaded whole are not split into chunks
+func (s *Server) handleMissingChunks(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Chunks []string `json:"chunks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	missing := []string{}
+	for _, hash := range request.Chunks {
+		if !validChunkHash(hash) {
+			http.Error(w, "invalid chunk hash "+hash, http.StatusBadRequest)
+			return
+		}
+		if _, err := os.Stat(s.chunkFile(hash)); err != nil {
+			missing = append(missing, hash)
+		}
+	}
+
+	writeJSON(w, map[string][]string{"missing": missing})
+}
+
+func (s *Server) handlePutChunk(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if !validChunkHash(hash) {
+		http.Error(w, "invalid chunk hash", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, chunking.MaxSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > chunking.MaxSize || chunking.Hash(data) != hash {
+		http.Error(w, "chunk does not match its hash", http.StatusBadRequest)
+		return
+	}
+
+	if err := os.MkdirAll(s.chunksDir(), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	temp, err := os.CreateTemp(s.chunksDir(), "chunk-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), s.chunkFile(hash))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleCommitManifest(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Path     string            `json:"path"`
+		Chunks   []models.Chunk    `json:"chunks"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	remotePath, err := cleanPath(request.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	algorithm, err := hashing.ParseAlgorithm(request.Metadata["checksumAlgorithm"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, chunk := range request.Chunks {
+		if !validChunkHash(chunk.Hash) {
+			http.Error(w, "invalid chunk hash "+chunk.Hash, http.StatusBadRequest)
+			return
+		}
+		if _, err := os.Stat(s.chunkFile(chunk.Hash)); err != nil {
+			http.Error(w, "missing chunk "+chunk.Hash, http.StatusBadRequest)
+			return
+		}
+	}
+
+	content, contentWriter := io.Pipe()
+	go func() {
+		digest, _ := algorithm.New()
+		writer := io.MultiWriter(contentWriter, digest)
+		for _, chunk := range request.Chunks {
+			data, err := os.ReadFile(s.chunkFile(chunk.Hash))
+			if err != nil {
+				contentWriter.CloseWithError(err)
+				return
+			}
+			if _, err := writer.Write(data); err != nil {
+				contentWriter.CloseWithError(err)
+				return
+			}
+		}
+		// A mismatch fails the write, the previous version is kept
+		expected := request.Metadata["checksum"]
+		if checksum := hex.EncodeToString(digest.Sum(nil)); expected != "" && checksum != expected {
+			contentWriter.CloseWithError(fmt.Errorf("checksum mismatch: expected %s, got %s", expected, checksum))
+			return
+		}
+		contentWriter.Close()
+	}()
+
+	err = s.writeFile(remotePath, content)
+	content.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.metadata[remotePath] = request.Metadata
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// version returns the version recorded in the metadata of a file
+func (s *Server) version(remotePath string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version, err := strconv.Atoi(s.metadata[remotePath]["version"]); err == nil {
+		return version
+	}
+	return 1
+}
+
+// session returns the upload session with the given ID, or nil
+func (s *Server) session(id string) *uploadSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+// uploadsDir holds the data of upload sessions in progress
+func (s *Server) uploadsDir() string {
+	return filepath.Join(s.root, ".uploads")
+}
+
+// sessionFile is where the data of an upload session is accumulated
+func (s *Server) sessionFile(id string) string {
+	return filepath.Join(s.uploadsDir(), id)
+}
+
+// chunksDir holds the uploaded chunks, named by their hash
+func (s *Server) chunksDir() string {
+	return filepath.Join(s.uploadsDir(), "chunks")
+}
+
+// chunkFile is where the data of the chunk with hash is stored
+func (s *Server) chunkFile(hash string) string {
+	return filepath.Join(s.chunksDir(), hash)
+}
+
+// localPath maps a cleaned remote path to its location under root
+func (s *Server) localPath(remotePath string) string {
+	return filepath.Join(s.root, filepath.FromSlash(remotePath))
+}
+
+// cleanPath normalizes a remote path and rejects paths escaping the root
+func cleanPath(remotePath string) (string, error) {
+	cleaned := path.Clean("/" + remotePath)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid path %q", remotePath)
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
+
+// newSessionID returns a random upload session ID
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// validChunkHash reports whether hash is a SHA-256 in hex, which also keeps
+// it from escaping the chunk directory
+func validChunkHash(hash string) bool {
+	decoded, err := hex.DecodeString(hash)
+	return err == nil && len(decoded) == 32
+}
+
+// writeSession writes the state of an upload session as JSON
+func writeSession(w http.ResponseWriter, session *uploadSession) {
+	writeJSON(w, map[string]any{
+		"sessionId": session.id,
+		"offset":    session.offset,
+	})
+}
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
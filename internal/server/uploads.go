@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ChunkSize is the amount of data sent per request in a resumable upload
+const ChunkSize = 8 * 1024 * 1024
+
+// uploadSessionResponse is returned by every upload session endpoint
+type uploadSessionResponse struct {
+	SessionID string `json:"sessionId"`
+	Offset    int64  `json:"offset"`
+}
+
+// CreateUploadSession starts a resumable upload of size bytes to path and
+// returns the session ID. The metadata is applied when the upload completes.
+func (c *Client) CreateUploadSession(path string, size int64, metadata map[string]string) (string, error) {
+	if c.authToken == "" {
+		return "", ErrAuthExpired
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"path":     path,
+		"size":     size,
+		"metadata": metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal upload session: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/uploads", bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	result, err := c.doUploadSessionRequest(c.httpClient, req, "create upload session")
+	if err != nil {
+		return "", err
+	}
+
+	return result.SessionID, nil
+}
+
+// GetUploadOffset returns the number of bytes the server has confirmed for
+// an upload session
+func (c *Client) GetUploadOffset(sessionID string) (int64, error) {
+	if c.authToken == "" {
+		return 0, ErrAuthExpired
+	}
+
+	req, err := http.NewRequest("GET", c.baseURL+"/api/uploads/"+url.PathEscape(sessionID), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	result, err := c.doUploadSessionRequest(c.httpClient, req, "upload status")
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Offset, nil
+}
+
+// UploadChunk sends length bytes from chunk starting at offset and returns
+// the offset confirmed by the server. Cancelling ctx stops the upload, the
+// session keeps what the server confirmed.
+func (c *Client) UploadChunk(ctx context.Context, sessionID string, offset int64, chunk io.Reader, length int64) (int64, error) {
+	if c.authToken == "" {
+		return 0, ErrAuthExpired
+	}
+
+	endpoint := c.baseURL + "/api/uploads/" + url.PathEscape(sessionID) + "?offset=" + strconv.FormatInt(offset, 10)
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, c.uploadLimiter.Reader(ctx, chunk))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	result, err := c.doUploadSessionRequest(c.transferClient, req, "upload chunk")
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Offset, nil
+}
+
+// CompleteUploadSession finalizes an upload once every chunk was confirmed
+func (c *Client) CompleteUploadSession(sessionID string) error {
+	if c.authToken == "" {
+		return ErrAuthExpired
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/uploads/"+url.PathEscape(sessionID)+"/complete", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	_, err = c.doUploadSessionRequest(c.httpClient, req, "complete upload")
+	return err
+}
+
+// doUploadSessionRequest sends an authenticated upload session request and
+// decodes the session state from the response
+func (c *Client) doUploadSessionRequest(httpClient *http.Client, req *http.Request, action string) (*uploadSessionResponse, error) {
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, requestError(action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(action, resp)
+	}
+
+	var result uploadSessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse %s response: %w", action, err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetChecksum returns the cached checksum of the file with fileID, or an
+// empty string if none was cached for its current size and modification
+// time
+func (m *MetadataStore) GetChecksum(fileID uint64, size int64, modTime time.Time, algorithm string) (string, error) {
+	var checksum string
+	err := m.db.QueryRow(
+		"SELECT checksum FROM checksums WHERE file_id = ? AND algorithm = ? AND size = ? AND modified = ?",
+		int64(fileID),
+		algorithm,
+		size,
+		modTime.UnixNano(),
+	).Scan(&checksum)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get checksum: %w", err)
+	}
+
+	return checksum, nil
+}
+
+// SaveChecksum caches the checksum of the file with fileID. Only the latest
+// checksum of a file is kept.
+func (m *MetadataStore) SaveChecksum(fileID uint64, size int64, modTime time.Time, algorithm, checksum string) error {
+	_, err := m.db.Exec(
+		`INSERT INTO checksums (file_id, algorithm, size, modified, checksum) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(file_id, algorithm) DO UPDATE SET
+			size = excluded.size,
+			modified = excluded.modified,
+			checksum = excluded.checksum`,
+		int64(fileID),
+		algorithm,
+		size,
+		modTime.UnixNano(),
+		checksum,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save checksum: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// SaveConflict records a conflict between a file and its conflicted copy
+func (m *MetadataStore) SaveConflict(conflict *models.Conflict) error {
+	_, err := m.db.Exec(
+		`INSERT INTO conflicts (copy_path, path, device, detected_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(copy_path) DO UPDATE SET
+			path = excluded.path,
+			device = excluded.device,
+			detected_at = excluded.detected_at`,
+		conflict.CopyPath,
+		conflict.Path,
+		conflict.Device,
+		conflict.DetectedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save conflict: %w", err)
+	}
+
+	return nil
+}
+
+// GetConflict returns the conflict of a conflicted copy, or nil if there is
+// none
+func (m *MetadataStore) GetConflict(copyPath string) (*models.Conflict, error) {
+	conflict, err := scanConflict(m.db.QueryRow(
+		"SELECT copy_path, path, device, detected_at FROM conflicts WHERE copy_path = ?",
+		copyPath,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get conflict: %w", err)
+	}
+
+	return conflict, nil
+}
+
+// ListConflicts returns every unresolved conflict, oldest first
+func (m *MetadataStore) ListConflicts() ([]*models.Conflict, error) {
+	rows, err := m.db.Query("SELECT copy_path, path, device, detected_at FROM conflicts ORDER BY detected_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conflicts: %w", err)
+	}
+	defer rows.Close()
+
+	var conflicts []*models.Conflict
+	for rows.Next() {
+		conflict, err := scanConflict(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conflict: %w", err)
+		}
+
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts, rows.Err()
+}
+
+// DeleteConflict removes a resolved conflict
+func (m *MetadataStore) DeleteConflict(copyPath string) error {
+	_, err := m.db.Exec("DELETE FROM conflicts WHERE copy_path = ?", copyPath)
+	return err
+}
+
+// scanConflict reads a single conflicts row
+func scanConflict(row rowScanner) (*models.Conflict, error) {
+	var conflict models.Conflict
+	var detectedAt int64
+
+	err := row.Scan(
+		&conflict.CopyPath,
+		&conflict.Path,
+		&conflict.Device,
+		&detectedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conflict.DetectedAt = time.Unix(detectedAt, 0)
+
+	return &conflict, nil
+}
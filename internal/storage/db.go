@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+	"unicode/utf8"
 
 	"homecloud/internal/models"
 
@@ -31,6 +32,10 @@ func NewMetadataStore(appDataPath string) (*MetadataStore, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// The sync pipeline writes from several goroutines; serialize them on a
+	// single connection so SQLite never reports the database as locked
+	db.SetMaxOpenConns(1)
+
 	// Create tables if they don't exist
 	if err := initDatabase(db); err != nil {
 		db.Close()
@@ -45,58 +50,21 @@ func (m *MetadataStore) Close() error {
 	return m.db.Close()
 }
 
-// SaveFileInfo saves or updates file information
-func (m *MetadataStore) SaveFileInfo(info *models.FileInfo) error {
-	// Check if file exists
-	var exists bool
-	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM files WHERE path = ?)", info.Path).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check file existence: %w", err)
-	}
-
-	if exists {
-		// Update existing file
-		_, err = m.db.Exec(
-			"UPDATE files SET status = ?, last_modified = ?, size = ?, is_downloaded = ?, is_directory = ?, version = ?, checksum = ?, last_synced = ? WHERE path = ?",
-			string(info.Status),
-			info.LastModified.Unix(),
-			info.Size,
-			info.IsDownloaded,
-			info.IsDirectory,
-			info.Version,
-			info.Checksum,
-			info.LastSynced.Unix(),
-			info.Path,
-		)
-	} else {
-		// Insert new file
-		_, err = m.db.Exec(
-			"INSERT INTO files (path, status, last_modified, size, is_downloaded, is_directory, version, checksum, last_synced) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			info.Path,
-			string(info.Status),
-			info.LastModified.Unix(),
-			info.Size,
-			info.IsDownloaded,
-			info.IsDirectory,
-			info.Version,
-			info.Checksum,
-			info.LastSynced.Unix(),
-		)
-	}
+// fileColumns lists the columns of the files table in the order expected by scanFileInfo
+const fileColumns = "path, status, last_modified, size, is_downloaded, is_directory, version, checksum, last_synced, last_error, inode, retries, next_retry, checksum_algorithm"
 
-	return err
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// GetFileInfo retrieves file information by path
-func (m *MetadataStore) GetFileInfo(path string) (*models.FileInfo, error) {
+// scanFileInfo reads a single files row selected with fileColumns
+func scanFileInfo(row rowScanner) (*models.FileInfo, error) {
 	var info models.FileInfo
-	var lastModified, lastSynced int64
+	var lastModified, lastSynced, inode, nextRetry int64
 	var statusStr string
 
-	err := m.db.QueryRow(
-		"SELECT path, status, last_modified, size, is_downloaded, is_directory, version, checksum, last_synced FROM files WHERE path = ?",
-		path,
-	).Scan(
+	err := row.Scan(
 		&info.Path,
 		&statusStr,
 		&lastModified,
@@ -106,25 +74,30 @@ func (m *MetadataStore) GetFileInfo(path string) (*models.FileInfo, error) {
 		&info.Version,
 		&info.Checksum,
 		&lastSynced,
+		&info.Error,
+		&inode,
+		&info.Retries,
+		&nextRetry,
+		&info.ChecksumAlgorithm,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return nil, err
 	}
 
 	info.Status = models.SyncStatus(statusStr)
+	info.Inode = uint64(inode)
 	info.LastModified = time.Unix(lastModified, 0)
 	info.LastSynced = time.Unix(lastSynced, 0)
+	if nextRetry != 0 {
+		info.NextRetry = time.Unix(nextRetry, 0)
+	}
 
 	return &info, nil
 }
 
-// ListAllFiles returns all file metadata
-func (m *MetadataStore) ListAllFiles() ([]*models.FileInfo, error) {
-	rows, err := m.db.Query("SELECT path, status, last_modified, size, is_downloaded, is_directory, version, checksum, last_synced FROM files")
+// queryFileInfos runs a query selecting fileColumns and returns every row
+func (m *MetadataStore) queryFileInfos(query string, args ...any) ([]*models.FileInfo, error) {
+	rows, err := m.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query files: %w", err)
 	}
@@ -132,33 +105,82 @@ func (m *MetadataStore) ListAllFiles() ([]*models.FileInfo, error) {
 
 	var files []*models.FileInfo
 	for rows.Next() {
-		var info models.FileInfo
-		var lastModified, lastSynced int64
-		var statusStr string
-
-		err := rows.Scan(
-			&info.Path,
-			&statusStr,
-			&lastModified,
-			&info.Size,
-			&info.IsDownloaded,
-			&info.IsDirectory,
-			&info.Version,
-			&info.Checksum,
-			&lastSynced,
-		)
+		info, err := scanFileInfo(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan file: %w", err)
 		}
 
-		info.Status = models.SyncStatus(statusStr)
-		info.LastModified = time.Unix(lastModified, 0)
-		info.LastSynced = time.Unix(lastSynced, 0)
+		files = append(files, info)
+	}
+
+	return files, rows.Err()
+}
+
+// SaveFileInfo saves or updates file information
+func (m *MetadataStore) SaveFileInfo(info *models.FileInfo) error {
+	_, err := m.db.Exec(
+		`INSERT INTO files (`+fileColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			status = excluded.status,
+			last_modified = excluded.last_modified,
+			size = excluded.size,
+			is_downloaded = excluded.is_downloaded,
+			is_directory = excluded.is_directory,
+			version = excluded.version,
+			checksum = excluded.checksum,
+			last_synced = excluded.last_synced,
+			last_error = excluded.last_error,
+			inode = excluded.inode,
+			retries = excluded.retries,
+			next_retry = excluded.next_retry,
+			checksum_algorithm = excluded.checksum_algorithm`,
+		info.Path,
+		string(info.Status),
+		info.LastModified.Unix(),
+		info.Size,
+		info.IsDownloaded,
+		info.IsDirectory,
+		info.Version,
+		info.Checksum,
+		info.LastSynced.Unix(),
+		info.Error,
+		// SQLite integers are signed, the bits are kept as they are
+		int64(info.Inode),
+		info.Retries,
+		unixOrZero(info.NextRetry),
+		info.ChecksumAlgorithm,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save file info: %w", err)
+	}
+
+	return nil
+}
+
+// unixOrZero returns the Unix time of t, or zero for the zero time
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
 
-		files = append(files, &info)
+// GetFileInfo retrieves file information by path
+func (m *MetadataStore) GetFileInfo(path string) (*models.FileInfo, error) {
+	info, err := scanFileInfo(m.db.QueryRow("SELECT "+fileColumns+" FROM files WHERE path = ?", path))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	return files, nil
+	return info, nil
+}
+
+// ListAllFiles returns all file metadata
+func (m *MetadataStore) ListAllFiles() ([]*models.FileInfo, error) {
+	return m.queryFileInfos("SELECT " + fileColumns + " FROM files")
 }
 
 // DeleteFileInfo removes a file from the database
@@ -167,43 +189,57 @@ func (m *MetadataStore) DeleteFileInfo(path string) error {
 	return err
 }
 
-// GetSyncQueue returns files that need to be synchronized
-func (m *MetadataStore) GetSyncQueue() ([]*models.FileInfo, error) {
-	rows, err := m.db.Query("SELECT path, status, last_modified, size, is_downloaded, is_directory, version, checksum, last_synced FROM files WHERE status != ?", string(models.StatusSynced))
+// MoveFileInfo moves the record of a file, and those of the files inside it
+// if it is a directory, to a new path. Versions and checksums are kept, and
+// records already at the destination are replaced.
+func (m *MetadataStore) MoveFileInfo(oldPath, newPath string) error {
+	// Children are matched with substr rather than LIKE, paths may contain
+	// LIKE wildcards. SQLite counts characters, not bytes.
+	oldPrefix := oldPath + string(filepath.Separator)
+	newPrefix := newPath + string(filepath.Separator)
+
+	tx, err := m.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query sync queue: %w", err)
+		return fmt.Errorf("failed to begin move: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var files []*models.FileInfo
-	for rows.Next() {
-		var info models.FileInfo
-		var lastModified, lastSynced int64
-		var statusStr string
-
-		err := rows.Scan(
-			&info.Path,
-			&statusStr,
-			&lastModified,
-			&info.Size,
-			&info.IsDownloaded,
-			&info.IsDirectory,
-			&info.Version,
-			&info.Checksum,
-			&lastSynced,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan file: %w", err)
-		}
+	_, err = tx.Exec(
+		"DELETE FROM files WHERE path = ? OR substr(path, 1, ?) = ?",
+		newPath,
+		utf8.RuneCountInString(newPrefix),
+		newPrefix,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clear move destination: %w", err)
+	}
 
-		info.Status = models.SyncStatus(statusStr)
-		info.LastModified = time.Unix(lastModified, 0)
-		info.LastSynced = time.Unix(lastSynced, 0)
+	_, err = tx.Exec(
+		`UPDATE files SET path = CASE WHEN path = ? THEN ? ELSE ? || substr(path, ?) END
+		WHERE path = ? OR substr(path, 1, ?) = ?`,
+		oldPath,
+		newPath,
+		newPrefix,
+		utf8.RuneCountInString(oldPrefix)+1,
+		oldPath,
+		utf8.RuneCountInString(oldPrefix),
+		oldPrefix,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to move file info: %w", err)
+	}
 
-		files = append(files, &info)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit move: %w", err)
 	}
 
-	return files, nil
+	return nil
+}
+
+// GetSyncQueue returns files that need to be synchronized. A file is
+// queued by saving it with any status other than synced.
+func (m *MetadataStore) GetSyncQueue() ([]*models.FileInfo, error) {
+	return m.queryFileInfos("SELECT "+fileColumns+" FROM files WHERE status != ?", string(models.StatusSynced))
 }
 
 // Initialize database schema
@@ -223,6 +259,81 @@ func initDatabase(db *sql.DB) error {
 		
 		CREATE INDEX IF NOT EXISTS idx_files_status ON files(status);
 	`)
-	
-	return err
+	if err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	return migrateDatabase(db)
+}
+
+// migrations upgrade an existing schema. Each entry runs exactly once, in
+// order, and the number applied is tracked in SQLite's user_version pragma.
+// Only ever append to this list.
+var migrations = []string{
+	`ALTER TABLE files ADD COLUMN last_error TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE upload_sessions (
+		path TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL,
+		remote_path TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		checksum TEXT NOT NULL,
+		confirmed_offset INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE conflicts (
+		copy_path TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		device TEXT NOT NULL,
+		detected_at INTEGER NOT NULL
+	)`,
+	`ALTER TABLE files ADD COLUMN inode INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE files ADD COLUMN retries INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE files ADD COLUMN next_retry INTEGER NOT NULL DEFAULT 0`,
+	// Checksums recorded so far were all MD5
+	`ALTER TABLE files ADD COLUMN checksum_algorithm TEXT NOT NULL DEFAULT 'md5'`,
+	`CREATE TABLE checksums (
+		file_id INTEGER NOT NULL,
+		algorithm TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		modified INTEGER NOT NULL,
+		checksum TEXT NOT NULL,
+		PRIMARY KEY (file_id, algorithm)
+	)`,
+	`CREATE TABLE manifests (
+		checksum TEXT NOT NULL,
+		algorithm TEXT NOT NULL,
+		chunks TEXT NOT NULL,
+		PRIMARY KEY (checksum, algorithm)
+	)`,
+}
+
+// migrateDatabase applies the migrations that have not run yet
+func migrateDatabase(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"homecloud/internal/models"
+)
+
+// GetManifest returns the chunks of the file version with checksum, or nil
+// if no manifest was saved for it
+func (m *MetadataStore) GetManifest(checksum, algorithm string) ([]models.Chunk, error) {
+	var data string
+	err := m.db.QueryRow(
+		"SELECT chunks FROM manifests WHERE checksum = ? AND algorithm = ?",
+		checksum,
+		algorithm,
+	).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+
+	var chunks []models.Chunk
+	if err := json.Unmarshal([]byte(data), &chunks); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return chunks, nil
+}
+
+// SaveManifest saves the chunks of the file version with checksum. Files
+// with the same content share a manifest.
+func (m *MetadataStore) SaveManifest(checksum, algorithm string, chunks []models.Chunk) error {
+	data, err := json.Marshal(chunks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	_, err = m.db.Exec(
+		`INSERT INTO manifests (checksum, algorithm, chunks) VALUES (?, ?, ?)
+		ON CONFLICT(checksum, algorithm) DO UPDATE SET chunks = excluded.chunks`,
+		checksum,
+		algorithm,
+		string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	return nil
+}
+
+// PruneManifests deletes the manifests of versions no file is recorded with
+// anymore
+func (m *MetadataStore) PruneManifests() error {
+	_, err := m.db.Exec(
+		`DELETE FROM manifests WHERE NOT EXISTS (
+			SELECT 1 FROM files WHERE files.checksum = manifests.checksum AND files.checksum_algorithm = manifests.algorithm
+		)`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune manifests: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// SaveUploadSession saves or updates the state of a resumable upload
+func (m *MetadataStore) SaveUploadSession(session *models.UploadSession) error {
+	_, err := m.db.Exec(
+		`INSERT INTO upload_sessions (path, session_id, remote_path, size, checksum, confirmed_offset, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			session_id = excluded.session_id,
+			remote_path = excluded.remote_path,
+			size = excluded.size,
+			checksum = excluded.checksum,
+			confirmed_offset = excluded.confirmed_offset,
+			updated_at = excluded.updated_at`,
+		session.Path,
+		session.SessionID,
+		session.RemotePath,
+		session.Size,
+		session.Checksum,
+		session.Offset,
+		session.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateUploadOffset records the offset confirmed by the server
+func (m *MetadataStore) UpdateUploadOffset(path string, offset int64) error {
+	_, err := m.db.Exec(
+		"UPDATE upload_sessions SET confirmed_offset = ?, updated_at = ? WHERE path = ?",
+		offset,
+		time.Now().Unix(),
+		path,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update upload offset: %w", err)
+	}
+
+	return nil
+}
+
+// GetUploadSession returns the resumable upload of a local path, or nil if
+// there is none
+func (m *MetadataStore) GetUploadSession(path string) (*models.UploadSession, error) {
+	session, err := scanUploadSession(m.db.QueryRow(
+		"SELECT path, session_id, remote_path, size, checksum, confirmed_offset, updated_at FROM upload_sessions WHERE path = ?",
+		path,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListUploadSessions returns every unfinished resumable upload
+func (m *MetadataStore) ListUploadSessions() ([]*models.UploadSession, error) {
+	rows, err := m.db.Query("SELECT path, session_id, remote_path, size, checksum, confirmed_offset, updated_at FROM upload_sessions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query upload sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.UploadSession
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload session: %w", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteUploadSession forgets the resumable upload of a local path
+func (m *MetadataStore) DeleteUploadSession(path string) error {
+	_, err := m.db.Exec("DELETE FROM upload_sessions WHERE path = ?", path)
+	return err
+}
+
+// scanUploadSession reads a single upload_sessions row
+func scanUploadSession(row rowScanner) (*models.UploadSession, error) {
+	var session models.UploadSession
+	var updatedAt int64
+
+	err := row.Scan(
+		&session.Path,
+		&session.SessionID,
+		&session.RemotePath,
+		&session.Size,
+		&session.Checksum,
+		&session.Offset,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &session, nil
+}
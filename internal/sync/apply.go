@@ -0,0 +1,340 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+	"homecloud/pkg/common"
+)
+
+// applyPlan applies the actions of a plan one after the other. A failing
+// action does not stop the others, it is reported on the file instead.
+func (sm *SyncManager) applyPlan(plan []Action) {
+	for _, action := range plan {
+		if err := sm.applyAction(action); err != nil {
+			fmt.Printf("failed to %s %s: %v\n", action.Type, action.Path, err)
+		}
+	}
+}
+
+// applyAction performs a single action of a sync plan
+func (sm *SyncManager) applyAction(action Action) error {
+	unlock := sm.locks.lock(action.Path)
+	defer unlock()
+
+	localPath, err := sm.localPath(action.Path)
+	if err != nil {
+		return err
+	}
+
+	if !sm.transferAllowed(action.Type, time.Now()) {
+		return sm.deferAction(localPath, action)
+	}
+
+	if err := sm.enqueueAction(localPath, action); err != nil {
+		return fmt.Errorf("failed to queue: %w", err)
+	}
+
+	// Pause cancels the transfers made with ctx
+	ctx, done := sm.startTransfer()
+	defer done()
+
+	switch action.Type {
+	case ActionUpload:
+		sm.markSyncing(localPath)
+		info, err := sm.uploadFile(ctx, localPath, action.Path, action.Local, action.Remote, action.Base)
+		return sm.finishAction(ctx, localPath, info, err)
+
+	case ActionDownload:
+		sm.markSyncing(localPath)
+		var info *models.FileInfo
+		switch {
+		case action.Remote.IsDirectory:
+			info, err = sm.createLocalDirectory(localPath, action.Remote, !sm.keepOnline(localPath, action.Base))
+		case sm.keepOnline(localPath, action.Base):
+			info, err = sm.savePlaceholder(localPath, action.Remote)
+		default:
+			info, err = sm.downloadFile(ctx, action.Path, localPath, action.Remote.Version)
+		}
+		return sm.finishAction(ctx, localPath, info, err)
+
+	case ActionConflict:
+		info, err := sm.keepBothVersions(ctx, localPath, action.Path, action.Local, action.Remote)
+		return sm.finishAction(ctx, localPath, info, err)
+
+	case ActionDeleteLocal:
+		return sm.deleteLocal(localPath)
+
+	case ActionDeleteRemote:
+		return sm.deleteRemote(action.Path, localPath)
+
+	case ActionRenameLocal:
+		return sm.renameLocal(ctx, localPath, action)
+
+	case ActionRenameRemote:
+		return sm.renameRemote(ctx, localPath, action)
+
+	case ActionRecord:
+		return sm.recordAgreement(localPath, action)
+
+	case ActionForget:
+		return sm.forgetRecord(localPath)
+	}
+
+	return fmt.Errorf("unknown action %q", action.Type)
+}
+
+// enqueueAction persists an action before it is applied. Renames queue
+// both of their paths, so a replay sees the move again.
+func (sm *SyncManager) enqueueAction(localPath string, action Action) error {
+	switch action.Type {
+	case ActionRecord, ActionForget:
+		// Applied in a single store write
+		return nil
+	case ActionRenameLocal, ActionRenameRemote:
+		newLocalPath, err := sm.localPath(action.NewPath)
+		if err != nil {
+			return err
+		}
+		if err := sm.enqueue(newLocalPath, models.StatusSyncing); err != nil {
+			return err
+		}
+	}
+
+	return sm.enqueue(localPath, models.StatusSyncing)
+}
+
+// finishAction publishes the outcome of a transfer made with ctx. A
+// transfer stopped by Pause is no failure, the file stays queued.
+func (sm *SyncManager) finishAction(ctx context.Context, localPath string, info *models.FileInfo, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return sm.requeue(localPath)
+	}
+	if err != nil {
+		sm.markFileError(localPath, err)
+		return err
+	}
+
+	sm.setFileInfo(info)
+	return nil
+}
+
+// markSyncing flags a file as being transferred
+func (sm *SyncManager) markSyncing(path string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	info, exists := sm.fileInfos[path]
+	if !exists {
+		info = &models.FileInfo{Path: path}
+		sm.fileInfos[path] = info
+	}
+	info.Status = models.StatusSyncing
+
+	updatedInfo := *info
+	sm.notify(&updatedInfo)
+}
+
+// createLocalDirectory creates a directory that exists on the server.
+// downloaded tells whether the files added to it are downloaded or left
+// online only.
+func (sm *SyncManager) createLocalDirectory(localPath string, remote *models.FileInfo, downloaded bool) (*models.FileInfo, error) {
+	release := sm.suppressEvents(localPath)
+	defer release()
+
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	info := &models.FileInfo{
+		Path:         localPath,
+		Status:       models.StatusSynced,
+		LastModified: remote.LastModified,
+		IsDownloaded: downloaded,
+		IsDirectory:  true,
+		Version:      remote.Version,
+		LastSynced:   time.Now(),
+	}
+	return info, sm.saveFileInfo(info)
+}
+
+// deleteLocal removes a file that was deleted on the server. Directories
+// are only removed once empty, so nothing that was never synced is lost.
+func (sm *SyncManager) deleteLocal(localPath string) error {
+	release := sm.suppressEvents(localPath)
+	defer release()
+
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %w", filepath.Base(localPath), err)
+	}
+
+	return sm.forgetRecord(localPath)
+}
+
+// deleteRemote removes a file from the server after it was deleted locally
+func (sm *SyncManager) deleteRemote(remotePath, localPath string) error {
+	if err := sm.client.DeleteFile(remotePath); err != nil && !errors.Is(err, server.ErrNotFound) {
+		sm.markFileError(localPath, err)
+		return err
+	}
+
+	return sm.forgetRecord(localPath)
+}
+
+// renameLocal applies a move made on the server to the local file. The
+// stored record moves along so the version history is kept, and the content
+// is downloaded if it also changed.
+func (sm *SyncManager) renameLocal(ctx context.Context, localPath string, action Action) error {
+	newLocalPath, err := sm.localPath(action.NewPath)
+	if err != nil {
+		return err
+	}
+
+	unlock := sm.locks.lock(action.NewPath)
+	defer unlock()
+
+	releaseOld := sm.suppressEvents(localPath)
+	defer releaseOld()
+	releaseNew := sm.suppressEvents(newLocalPath)
+	defer releaseNew()
+
+	if err := os.MkdirAll(filepath.Dir(newLocalPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// A placeholder has nothing on disk to move
+	_, statErr := os.Lstat(localPath)
+	placeholder := isPlaceholder(action.Base) && os.IsNotExist(statErr)
+	if !placeholder {
+		if err := os.Rename(localPath, newLocalPath); err != nil {
+			return fmt.Errorf("failed to move %s: %w", filepath.Base(localPath), err)
+		}
+	}
+
+	if err := sm.moveRecord(localPath, newLocalPath); err != nil {
+		return err
+	}
+
+	if placeholder {
+		info, err := sm.savePlaceholder(newLocalPath, action.Remote)
+		return sm.finishAction(ctx, newLocalPath, info, err)
+	}
+
+	if !sameContent(action.Remote, action.Base) {
+		sm.markSyncing(newLocalPath)
+		info, err := sm.downloadFile(ctx, action.NewPath, newLocalPath, action.Remote.Version)
+		return sm.finishAction(ctx, newLocalPath, info, err)
+	}
+
+	info := *action.Base
+	info.Path = newLocalPath
+	info.Status = models.StatusSynced
+	info.Version = action.Remote.Version
+	info.LastSynced = time.Now()
+	if stat, err := os.Stat(newLocalPath); err == nil {
+		info.LastModified = stat.ModTime()
+		info.Inode = common.FileID(newLocalPath, stat)
+	}
+
+	if err := sm.saveFileInfo(&info); err != nil {
+		return err
+	}
+	sm.setFileInfo(&info)
+
+	return nil
+}
+
+// renameRemote applies a local move to the server with a server-side move,
+// so nothing is uploaded again and the version history follows the file.
+// The content is uploaded only if it also changed.
+func (sm *SyncManager) renameRemote(ctx context.Context, localPath string, action Action) error {
+	newLocalPath, err := sm.localPath(action.NewPath)
+	if err != nil {
+		return err
+	}
+
+	unlock := sm.locks.lock(action.NewPath)
+	defer unlock()
+
+	sm.markSyncing(newLocalPath)
+	if err := sm.client.MoveFile(action.Path, action.NewPath); err != nil {
+		sm.markFileError(newLocalPath, err)
+		return err
+	}
+
+	if err := sm.moveRecord(localPath, newLocalPath); err != nil {
+		return err
+	}
+
+	moved := *action.Base
+	moved.Path = newLocalPath
+
+	if !sameContent(action.Local, action.Base) {
+		info, err := sm.uploadFile(ctx, newLocalPath, action.NewPath, action.Local, nil, &moved)
+		return sm.finishAction(ctx, newLocalPath, info, err)
+	}
+
+	moved.Status = models.StatusSynced
+	moved.LastModified = action.Local.LastModified
+	moved.Inode = action.Local.Inode
+	moved.LastSynced = time.Now()
+
+	if err := sm.saveFileInfo(&moved); err != nil {
+		return err
+	}
+	sm.setFileInfo(&moved)
+
+	return nil
+}
+
+// moveRecord moves the stored state of a file, and of everything inside it
+// for directories, to a new path
+func (sm *SyncManager) moveRecord(oldPath, newPath string) error {
+	if sm.store != nil {
+		if err := sm.store.MoveFileInfo(oldPath, newPath); err != nil {
+			return err
+		}
+	}
+
+	sm.forgetFile(oldPath)
+	return nil
+}
+
+// recordAgreement stores the state of a path that is identical on both
+// sides as the new base
+func (sm *SyncManager) recordAgreement(localPath string, action Action) error {
+	info := *action.Local
+	info.Path = localPath
+	info.Status = models.StatusSynced
+	info.IsDownloaded = true
+	info.Checksum = action.Remote.Checksum
+	info.ChecksumAlgorithm = action.Remote.ChecksumAlgorithm
+	info.Version = action.Remote.Version
+	info.LastSynced = time.Now()
+	info.Error = ""
+
+	if err := sm.saveFileInfo(&info); err != nil {
+		return err
+	}
+	sm.setFileInfo(&info)
+
+	return nil
+}
+
+// forgetRecord drops the stored state of a path that no longer exists
+func (sm *SyncManager) forgetRecord(localPath string) error {
+	if sm.store != nil {
+		if err := sm.store.DeleteFileInfo(localPath); err != nil {
+			return err
+		}
+	}
+
+	sm.forgetFile(localPath)
+	return nil
+}
@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"homecloud/internal/chunking"
+	"homecloud/internal/models"
+)
+
+// chunkThreshold is the file size from which uploads go through chunks the
+// server may already have. Smaller files are about one chunk, they are sent
+// whole.
+const chunkThreshold = 4 * chunking.AvgSize
+
+// chunkUploads is how many chunks are uploaded at once
+const chunkUploads = 4
+
+// missingChunksBatch bounds the number of chunks asked about in one request
+const missingChunksBatch = 1000
+
+// uploadChunked uploads a file as content-defined chunks. Only the chunks
+// the server does not have yet are sent, so copies, renames and edits of
+// files it already has cost little more than the manifest assembling them.
+func (sm *SyncManager) uploadChunked(ctx context.Context, path, remotePath string, info *models.FileInfo, metadata map[string]string) error {
+	chunks, err := sm.manifest(path, info)
+	if err != nil {
+		return err
+	}
+
+	missing, err := sm.missingChunks(chunks)
+	if err != nil {
+		return err
+	}
+
+	// Every missing chunk once, repeated content is sent a single time
+	var pending []pendingChunk
+	var offset int64
+	for _, chunk := range chunks {
+		if missing[chunk.Hash] {
+			pending = append(pending, pendingChunk{Chunk: chunk, offset: offset})
+			delete(missing, chunk.Hash)
+		}
+		offset += chunk.Size
+	}
+
+	if err := sm.putChunks(ctx, path, pending); err != nil {
+		return err
+	}
+
+	return sm.client.CommitManifest(remotePath, chunks, metadata)
+}
+
+// manifest returns the chunks of the version of the file described by info.
+// Splitting a version is done once, files with the same content share the
+// stored manifest.
+func (sm *SyncManager) manifest(path string, info *models.FileInfo) ([]models.Chunk, error) {
+	if sm.store != nil {
+		chunks, err := sm.store.GetManifest(info.Checksum, info.ChecksumAlgorithm)
+		if err != nil || chunks != nil {
+			return chunks, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// The content is hashed along, a manifest must never be stored for a
+	// version it does not belong to
+	h := sm.hasher.NewHash()
+	chunks, err := chunking.Manifest(io.TeeReader(file, h))
+	if err != nil {
+		return nil, err
+	}
+	if info.ChecksumAlgorithm != string(sm.hasher.Algorithm()) || hex.EncodeToString(h.Sum(nil)) != info.Checksum {
+		return nil, fmt.Errorf("%s changed while uploading", path)
+	}
+
+	if sm.store != nil {
+		if err := sm.store.SaveManifest(info.Checksum, info.ChecksumAlgorithm, chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	return chunks, nil
+}
+
+// missingChunks returns the hashes of the chunks the server does not have
+func (sm *SyncManager) missingChunks(chunks []models.Chunk) (map[string]bool, error) {
+	seen := make(map[string]bool, len(chunks))
+	var hashes []string
+	for _, chunk := range chunks {
+		if !seen[chunk.Hash] {
+			seen[chunk.Hash] = true
+			hashes = append(hashes, chunk.Hash)
+		}
+	}
+
+	missing := make(map[string]bool)
+	for start := 0; start < len(hashes); start += missingChunksBatch {
+		batch, err := sm.client.MissingChunks(hashes[start:min(start+missingChunksBatch, len(hashes))])
+		if err != nil {
+			return nil, err
+		}
+		for _, hash := range batch {
+			missing[hash] = true
+		}
+	}
+
+	return missing, nil
+}
+
+// pendingChunk is a chunk to upload and where it starts in the file
+type pendingChunk struct {
+	models.Chunk
+	offset int64
+}
+
+// putChunks uploads chunks of the file at path, several at once. The first
+// failure stops the upload.
+func (sm *SyncManager) putChunks(ctx context.Context, path string, chunks []pendingChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	jobs := make(chan pendingChunk)
+	errs := make(chan error, chunkUploads)
+	var wg sync.WaitGroup
+	for range min(chunkUploads, len(chunks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := make([]byte, chunking.MaxSize)
+			for chunk := range jobs {
+				if err := sm.putChunk(ctx, file, path, chunk, data); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+send:
+	for _, chunk := range chunks {
+		select {
+		case jobs <- chunk:
+		case err = <-errs:
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
+
+// putChunk reads a chunk from file into data and uploads it, checking it
+// still has the content it was addressed by
+func (sm *SyncManager) putChunk(ctx context.Context, file *os.File, path string, chunk pendingChunk, data []byte) error {
+	data = data[:chunk.Size]
+	if _, err := file.ReadAt(data, chunk.offset); err != nil {
+		return fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if chunking.Hash(data) != chunk.Hash {
+		return fmt.Errorf("%s changed while uploading", path)
+	}
+	return sm.client.PutChunk(ctx, chunk.Hash, data)
+}
@@ -0,0 +1,227 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// conflictDateFormat is used in the name of conflicted copies. It avoids
+// characters that are not allowed in Windows file names.
+const conflictDateFormat = "2006-01-02 150405"
+
+// keepBothVersions handles a file that changed locally and remotely since
+// the last sync. The local version is moved to a conflicted copy, which is
+// then uploaded as a new file, and the remote version is downloaded in its
+// place. The original file is flagged as conflicted until resolved. A folder
+// on one side and a file on the other are only flagged.
+func (sm *SyncManager) keepBothVersions(ctx context.Context, localPath, remotePath string, local, remote *models.FileInfo) (*models.FileInfo, error) {
+	if local.IsDirectory != remote.IsDirectory {
+		return sm.flagTypeConflict(localPath, local)
+	}
+
+	device := deviceName()
+	copyPath := conflictedCopyPath(localPath, device, time.Now())
+
+	releaseOriginal := sm.suppressEvents(localPath)
+	defer releaseOriginal()
+	releaseCopy := sm.suppressEvents(copyPath)
+	defer releaseCopy()
+
+	if err := os.Rename(localPath, copyPath); err != nil {
+		return nil, fmt.Errorf("failed to create conflicted copy: %w", err)
+	}
+
+	// The local version lives on as a new file, queued right away so it
+	// reaches the server even if the download below fails
+	sm.handleFileChange(copyPath, time.Now())
+
+	conflict := &models.Conflict{
+		Path:       localPath,
+		CopyPath:   copyPath,
+		Device:     device,
+		DetectedAt: time.Now(),
+	}
+	if sm.store != nil {
+		if err := sm.store.SaveConflict(conflict); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := sm.downloadFile(ctx, remotePath, localPath, remote.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Status = models.StatusConflict
+	if err := sm.saveFileInfo(info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// flagTypeConflict flags a path that is a folder on one side and a file on
+// the other. Neither fits in a conflicted copy of the other, so both are left
+// untouched until the user renames one of them. The base state is kept.
+func (sm *SyncManager) flagTypeConflict(localPath string, local *models.FileInfo) (*models.FileInfo, error) {
+	message := "is a file here and a folder on the server, rename one of them"
+	if local.IsDirectory {
+		message = "is a folder here and a file on the server, rename one of them"
+	}
+
+	record, err := sm.loadFileInfo(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		record = &models.FileInfo{Path: localPath, IsDirectory: local.IsDirectory, IsDownloaded: true}
+	}
+	record.Status = models.StatusConflict
+	record.Error = message
+
+	if err := sm.saveFileInfo(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// GetConflicts returns the unresolved conflicts inside the watch directory
+func (sm *SyncManager) GetConflicts() ([]*models.Conflict, error) {
+	if sm.store == nil {
+		return nil, nil
+	}
+
+	all, err := sm.store.ListConflicts()
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []*models.Conflict
+	for _, conflict := range all {
+		if _, err := sm.remotePath(conflict.Path); err == nil {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
+
+// ResolveConflict settles the conflict of a conflicted copy. Keeping the
+// local version moves the copy over the original, keeping the remote one
+// deletes the copy and keeping both only dismisses the conflict.
+func (sm *SyncManager) ResolveConflict(copyPath string, resolution models.ConflictResolution) error {
+	if sm.store == nil {
+		return fmt.Errorf("no metadata store available")
+	}
+
+	conflict, err := sm.store.GetConflict(copyPath)
+	if err != nil {
+		return err
+	}
+	if conflict == nil {
+		return fmt.Errorf("no conflict recorded for %s", copyPath)
+	}
+
+	switch resolution {
+	case models.ResolveKeepLocal:
+		if err := sm.discardConflictedCopy(conflict, func() error {
+			return os.Rename(conflict.CopyPath, conflict.Path)
+		}); err != nil {
+			return err
+		}
+		sm.handleFileChange(conflict.Path, time.Now())
+
+	case models.ResolveKeepRemote:
+		if err := sm.discardConflictedCopy(conflict, func() error {
+			return os.Remove(conflict.CopyPath)
+		}); err != nil {
+			return err
+		}
+		sm.clearConflictStatus(conflict.Path)
+
+	case models.ResolveKeepBoth:
+		sm.clearConflictStatus(conflict.Path)
+
+	default:
+		return fmt.Errorf("unknown conflict resolution %q", resolution)
+	}
+
+	return sm.store.DeleteConflict(copyPath)
+}
+
+// discardConflictedCopy removes the conflicted copy from the server, if it
+// was uploaded, then runs the local operation getting rid of it
+func (sm *SyncManager) discardConflictedCopy(conflict *models.Conflict, removeLocal func() error) error {
+	record, err := sm.store.GetFileInfo(conflict.CopyPath)
+	if err != nil {
+		return err
+	}
+
+	if record != nil && record.Status == models.StatusSynced {
+		remotePath, err := sm.remotePath(conflict.CopyPath)
+		if err != nil {
+			return err
+		}
+		if err := sm.client.DeleteFile(remotePath); err != nil {
+			return err
+		}
+	}
+
+	release := sm.suppressEvents(conflict.CopyPath)
+	defer release()
+
+	if err := removeLocal(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to discard conflicted copy: %w", err)
+	}
+
+	if err := sm.store.DeleteFileInfo(conflict.CopyPath); err != nil {
+		return err
+	}
+	sm.forgetFile(conflict.CopyPath)
+
+	return nil
+}
+
+// clearConflictStatus marks the original file of a resolved conflict as
+// synced again
+func (sm *SyncManager) clearConflictStatus(path string) {
+	record, err := sm.loadFileInfo(path)
+	if err != nil || record == nil || record.Status != models.StatusConflict {
+		return
+	}
+
+	record.Status = models.StatusSynced
+	if err := sm.saveFileInfo(record); err != nil {
+		fmt.Printf("failed to clear conflict of %s: %v\n", path, err)
+	}
+	sm.setFileInfo(record)
+}
+
+// conflictedCopyPath returns the path of the conflicted copy of a file, e.g.
+// "report (conflicted copy from laptop 2024-05-01 093000).docx"
+func conflictedCopyPath(path, device string, at time.Time) string {
+	dir, name := filepath.Split(path)
+
+	ext := filepath.Ext(name)
+	if ext == name {
+		// Dotfiles such as ".bashrc" have no extension
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	return filepath.Join(dir, fmt.Sprintf("%s (conflicted copy from %s %s)%s", base, device, at.Format(conflictDateFormat), ext))
+}
+
+// deviceName identifies this computer in conflicted copy names
+func deviceName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "unknown device"
+	}
+	return hostname
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"homecloud/internal/models"
+)
+
+// record returns the stored record of the slash-separated path below the
+// watch directory
+func (s *testSetup) record(t *testing.T, path string) *models.FileInfo {
+	t.Helper()
+
+	record, err := s.store.GetFileInfo(filepath.Join(s.watchDir, filepath.FromSlash(path)))
+	if err != nil {
+		t.Fatalf("GetFileInfo() error = %v", err)
+	}
+	return record
+}
+
+func TestConflictKeepsBothVersions(t *testing.T) {
+	s := newTestSetup(t)
+	writeFile(t, s.watchDir, "a.txt", []byte("local"))
+	writeFile(t, s.serverDir, "a.txt", []byte("remote"))
+	s.start(t)
+
+	eventually(t, "the remote version is downloaded", func() bool {
+		return hasContent(s.watchDir, "a.txt", []byte("remote"))
+	})
+	conflicts, err := s.manager.GetConflicts()
+	if err != nil || len(conflicts) != 1 {
+		t.Fatalf("GetConflicts() = %v, %v, want one conflict", conflicts, err)
+	}
+	if data, err := os.ReadFile(conflicts[0].CopyPath); err != nil || string(data) != "local" {
+		t.Errorf("conflicted copy holds %q, %v, want the local version", data, err)
+	}
+	if record := s.record(t, "a.txt"); record == nil || record.Status != models.StatusConflict {
+		t.Errorf("record = %+v, want a conflict", record)
+	}
+}
+
+func TestConflictFolderAndFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// local and remote are the files on each side, "name" is a folder
+		// on one of them
+		local, remote map[string]string
+	}{
+		{
+			name:   "folder here, file on the server",
+			local:  map[string]string{"name/inner.txt": "local"},
+			remote: map[string]string{"name": "remote"},
+		},
+		{
+			name:   "file here, folder on the server",
+			local:  map[string]string{"name": "local"},
+			remote: map[string]string{"name/inner.txt": "remote"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestSetup(t)
+			for path, content := range test.local {
+				writeFile(t, s.watchDir, path, []byte(content))
+			}
+			for path, content := range test.remote {
+				writeFile(t, s.serverDir, path, []byte(content))
+			}
+			s.start(t)
+
+			eventually(t, "the conflict is flagged", func() bool {
+				record := s.record(t, "name")
+				return record != nil && record.Status == models.StatusConflict && record.Error != ""
+			})
+
+			// Nothing was moved or replaced on either side
+			for path, content := range test.local {
+				if !hasContent(s.watchDir, path, []byte(content)) {
+					t.Errorf("local %s was changed", path)
+				}
+			}
+			for path, content := range test.remote {
+				if !hasContent(s.serverDir, path, []byte(content)) {
+					t.Errorf("remote %s was changed", path)
+				}
+			}
+			if conflicts, err := s.manager.GetConflicts(); err != nil || len(conflicts) != 0 {
+				t.Errorf("GetConflicts() = %v, %v, want no conflicted copy", conflicts, err)
+			}
+
+			// Renaming the local one out of the way settles it
+			if err := os.Rename(filepath.Join(s.watchDir, "name"), filepath.Join(s.watchDir, "renamed")); err != nil {
+				t.Fatal(err)
+			}
+			eventually(t, "both sides are synced", func() bool {
+				for path, content := range test.remote {
+					if !hasContent(s.watchDir, path, []byte(content)) {
+						return false
+					}
+				}
+				return s.synced("name")
+			})
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+)
+
+// deletionSettleDelay is how long local deletions are collected before the
+// tree is reconciled, so a large removal is judged as a whole
+const deletionSettleDelay = 2 * time.Second
+
+// minDeletesForPercent keeps the percentage limit from holding the deletion
+// of a handful of files in a small tree
+const minDeletesForPercent = 10
+
+// SetDeletionPrompt registers the function called when remote deletions are
+// held back and need the user's confirmation. It receives the paths that
+// would be deleted on the server.
+func (sm *SyncManager) SetDeletionPrompt(prompt func(paths []string)) {
+	sm.deleteMu.Lock()
+	defer sm.deleteMu.Unlock()
+	sm.deletionPrompt = prompt
+}
+
+// PendingDeletions returns the paths whose deletion on the server is waiting
+// for confirmation
+func (sm *SyncManager) PendingDeletions() []string {
+	sm.deleteMu.Lock()
+	defer sm.deleteMu.Unlock()
+
+	paths := make([]string, len(sm.heldDeletions))
+	for i, action := range sm.heldDeletions {
+		paths[i] = action.Path
+	}
+	return paths
+}
+
+// ConfirmDeletions deletes the held paths from the server
+func (sm *SyncManager) ConfirmDeletions() error {
+	held := sm.takeHeldDeletions()
+	if len(held) == 0 {
+		return fmt.Errorf("no deletions are waiting for confirmation")
+	}
+
+	sm.applyPlan(held)
+	return nil
+}
+
+// RestoreDeletions cancels the held deletions and downloads the files again
+func (sm *SyncManager) RestoreDeletions() error {
+	held := sm.takeHeldDeletions()
+	if len(held) == 0 {
+		return fmt.Errorf("no deletions are waiting for confirmation")
+	}
+
+	restore := make([]Action, len(held))
+	for i, action := range held {
+		restore[i] = Action{Type: ActionDownload, Path: action.Path, Remote: action.Remote, Base: action.Base}
+	}
+
+	sortActions(restore)
+	sm.applyPlan(restore)
+	return nil
+}
+
+// takeHeldDeletions returns and clears the held deletions
+func (sm *SyncManager) takeHeldDeletions() []Action {
+	sm.deleteMu.Lock()
+	defer sm.deleteMu.Unlock()
+
+	held := sm.heldDeletions
+	sm.heldDeletions = nil
+	return held
+}
+
+// scheduleDeletionCheck reconciles the tree once local deletions stopped
+// coming in
+func (sm *SyncManager) scheduleDeletionCheck() {
+	sm.deleteMu.Lock()
+	defer sm.deleteMu.Unlock()
+
+	if sm.deletionTimer != nil {
+		sm.deletionTimer.Stop()
+	}
+	sm.deletionTimer = time.AfterFunc(deletionSettleDelay, sm.SyncNow)
+}
+
+// guardDeletions is the mass-delete safety brake. When a plan deletes more
+// remote files than the configured limits allow, for instance because the
+// disk holding the watch directory was unmounted, the remote deletions are
+// taken out of the plan and held until the user confirms them. baseCount is
+// the number of files in the synced tree.
+func (sm *SyncManager) guardDeletions(plan []Action, baseCount int) []Action {
+	var deletions, rest []Action
+	for _, action := range plan {
+		if action.Type == ActionDeleteRemote {
+			deletions = append(deletions, action)
+		} else {
+			rest = append(rest, action)
+		}
+	}
+
+	if !sm.exceedsDeleteLimits(len(deletions), baseCount) {
+		return plan
+	}
+
+	sm.deleteMu.Lock()
+	sm.heldDeletions = deletions
+	prompt := sm.deletionPrompt
+	sm.deleteMu.Unlock()
+
+	fmt.Printf("holding %d remote deletions in %s until confirmed\n", len(deletions), sm.watchDir)
+	if prompt != nil {
+		prompt(sm.PendingDeletions())
+	}
+
+	return rest
+}
+
+// exceedsDeleteLimits reports whether deleting count of baseCount files
+// needs the user's confirmation
+func (sm *SyncManager) exceedsDeleteLimits(count, baseCount int) bool {
+	if count == 0 || sm.config == nil {
+		return false
+	}
+
+	if limit := sm.config.DeleteThresholdCount; limit > 0 && count > limit {
+		return true
+	}
+
+	limit := sm.config.DeleteThresholdPercent
+	if limit > 0 && baseCount > 0 && count >= minDeletesForPercent {
+		return float64(count)*100/float64(baseCount) > limit
+	}
+
+	return false
+}
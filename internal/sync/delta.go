@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"homecloud/internal/delta"
+	"homecloud/internal/models"
+)
+
+// deltaThreshold is the file size from which a changed file is transferred
+// as a delta of the version on the other side. Below it a delta saves too
+// little to be worth the extra round trip.
+const deltaThreshold = 1 << 20
+
+// canTransferDelta reports whether a file of size bytes that the other side
+// has a version of is transferred as a delta
+func canTransferDelta(size int64, other *models.FileInfo) bool {
+	return other != nil && !other.IsDirectory && other.Size > 0 && size >= deltaThreshold
+}
+
+// uploadDelta sends the changes between the server's version of remotePath
+// and the local file at path
+func (sm *SyncManager) uploadDelta(ctx context.Context, path, remotePath string, size int64, metadata map[string]string) error {
+	sig, baseChecksum, err := sm.client.GetSignature(remotePath, delta.BlockSize(size))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return sm.client.UploadDelta(ctx, remotePath, sig, baseChecksum, file, size, metadata, nil)
+}
+
+// downloadDelta writes the server's version of remotePath to tempPath,
+// rebuilt from the local file at localPath and the changes the server sends,
+// and returns its checksum
+func (sm *SyncManager) downloadDelta(ctx context.Context, remotePath, localPath, tempPath string) (string, error) {
+	base, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer base.Close()
+
+	stat, err := base.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	sig, err := delta.NewSignature(base, delta.BlockSize(stat.Size()))
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer file.Close()
+
+	h := sm.hasher.NewHash()
+	expected, algorithm, err := sm.client.DownloadDelta(ctx, remotePath, sig, base, io.MultiWriter(file, h), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	return sm.verifyDownload(remotePath, hex.EncodeToString(h.Sum(nil)), expected, algorithm)
+}
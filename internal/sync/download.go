@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"homecloud/internal/hashing"
+	"homecloud/internal/models"
+)
+
+// downloadSuffix marks the temporary files downloads are written to
+const downloadSuffix = ".homecloud-download"
+
+// DownloadFile fetches remotePath from the server into the watch directory.
+// While paused it fails and leaves the file as it was.
+func (sm *SyncManager) DownloadFile(remotePath string) error {
+	localPath, err := sm.localPath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	version := 1
+	if metadata, err := sm.client.GetFileMetadata(remotePath); err == nil {
+		if v, err := strconv.Atoi(metadata["version"]); err == nil {
+			version = v
+		}
+	}
+
+	ctx, done := sm.startTransfer()
+	defer done()
+
+	info, err := sm.downloadFile(ctx, remotePath, localPath, version)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errPaused
+		}
+		sm.markFileError(localPath, err)
+		return err
+	}
+
+	sm.setFileInfo(info)
+	return nil
+}
+
+// downloadFile streams remotePath into a temporary file next to localPath,
+// verifies it against the checksum reported by the server and renames it
+// over localPath, so the target is never left half written. The watcher is
+// told to ignore both files while this happens. The download stops when ctx
+// is cancelled.
+func (sm *SyncManager) downloadFile(ctx context.Context, remotePath, localPath string, version int) (*models.FileInfo, error) {
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tempPath := filepath.Join(dir, "."+filepath.Base(localPath)+downloadSuffix)
+
+	releaseTemp := sm.suppressEvents(tempPath)
+	defer releaseTemp()
+	releaseTarget := sm.suppressEvents(localPath)
+	defer releaseTarget()
+
+	checksum, err := sm.downloadToTemp(ctx, remotePath, localPath, tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tempPath, localPath); err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to move download into place: %w", err)
+	}
+
+	stat, err := os.Stat(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	info := &models.FileInfo{
+		Path:         localPath,
+		Status:       models.StatusSynced,
+		LastModified: stat.ModTime(),
+		Size:         stat.Size(),
+		IsDownloaded: true,
+		Version:      version,
+		Checksum:     checksum,
+		LastSynced:   time.Now(),
+	}
+	info.ChecksumAlgorithm = string(sm.hasher.Algorithm())
+
+	// The content was just hashed while downloading
+	sm.hasher.Remember(localPath, checksum)
+
+	return info, sm.saveFileInfo(info)
+}
+
+// downloadToTemp writes the content of remotePath to tempPath and returns
+// its checksum, verified against the one reported by the server. A large
+// local version of the file is used as the base of a delta.
+func (sm *SyncManager) downloadToTemp(ctx context.Context, remotePath, localPath, tempPath string) (string, error) {
+	if stat, err := os.Stat(localPath); err == nil && stat.Mode().IsRegular() && stat.Size() >= deltaThreshold {
+		checksum, err := sm.downloadDelta(ctx, remotePath, localPath, tempPath)
+		if err == nil || ctx.Err() != nil {
+			return checksum, err
+		}
+		fmt.Printf("failed to download %s as a delta, fetching it whole: %v\n", remotePath, err)
+	}
+
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer file.Close()
+
+	h := sm.hasher.NewHash()
+	expected, algorithm, err := sm.client.DownloadFile(ctx, remotePath, io.MultiWriter(file, h), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	return sm.verifyDownload(remotePath, hex.EncodeToString(h.Sum(nil)), expected, algorithm)
+}
+
+// verifyDownload checks the checksum of downloaded content against the one
+// reported by the server and returns it
+func (sm *SyncManager) verifyDownload(remotePath, checksum, expected string, algorithm hashing.Algorithm) (string, error) {
+	if expected == "" {
+		return "", fmt.Errorf("server did not report a checksum for %s", remotePath)
+	}
+	if algorithm != sm.hasher.Algorithm() {
+		return "", fmt.Errorf("server reported a %q checksum for %s, expected %s", algorithm, remotePath, sm.hasher.Algorithm())
+	}
+	if expected != checksum {
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", remotePath, expected, checksum)
+	}
+
+	return checksum, nil
+}
+
+// suppressEvents stops the watcher from reporting changes to path until the
+// returned function is called
+func (sm *SyncManager) suppressEvents(path string) func() {
+	if sm.watcher == nil {
+		return func() {}
+	}
+	return sm.watcher.Suppress(path)
+}
+
+// localPath converts a server path to its location inside the watch directory
+func (sm *SyncManager) localPath(remotePath string) (string, error) {
+	rel := remotePath
+	if sm.remoteRoot != "" {
+		var found bool
+		if rel, found = strings.CutPrefix(remotePath, sm.remoteRoot+"/"); !found {
+			return "", fmt.Errorf("remote path %s is outside of %s", remotePath, sm.remoteRoot)
+		}
+	}
+
+	localPath := filepath.Join(sm.watchDir, filepath.FromSlash(rel))
+	if _, err := sm.remotePath(localPath); err != nil || localPath == filepath.Clean(sm.watchDir) {
+		return "", fmt.Errorf("invalid remote path %s", remotePath)
+	}
+	return localPath, nil
+}
+
+// isTempDownload reports whether path is the temporary file of a download
+func isTempDownload(path string) bool {
+	return strings.HasSuffix(path, downloadSuffix)
+}
@@ -0,0 +1,46 @@
+package sync
+
+import (
+	"sync"
+)
+
+// pathLocks serializes the operations applied to the same path while
+// letting different paths proceed in parallel
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is a mutex shared by everyone operating on a path
+type pathLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// lock blocks until path is free and returns the function releasing it
+func (p *pathLocks) lock(path string) func() {
+	p.mu.Lock()
+	if p.locks == nil {
+		p.locks = make(map[string]*pathLock)
+	}
+	l, exists := p.locks[path]
+	if !exists {
+		l = &pathLock{}
+		p.locks[path] = l
+	}
+	l.waiters++
+	p.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		p.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			delete(p.locks, path)
+		}
+		p.mu.Unlock()
+	}
+}
@@ -2,77 +2,308 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"homecloud/internal/config"
 	"homecloud/internal/filesystem"
+	"homecloud/internal/hashing"
 	"homecloud/internal/models"
+	"homecloud/internal/server"
+	"homecloud/internal/storage"
 )
 
 // SyncManager handles file synchronization
 type SyncManager struct {
 	watchDir   string
+	remoteRoot string
+	client     *server.Client
+	store      *storage.MetadataStore
+	config     *config.Config
 	eventChan  chan models.FileEvent
-	watcher    *filesystem.Watcher
+	watcher    filesystem.Watcher
+	debouncer  *filesystem.Debouncer
+	ignore     *filesystem.IgnoreRules
+	hasher     *hashing.Hasher
 	fileInfos  map[string]*models.FileInfo
 	mu         sync.RWMutex
 	isRunning  bool
 	statusChan chan *models.FileInfo
+	pollChan   chan struct{}
+	rescanChan chan struct{}
+	stopChan   chan struct{}
+	locks      pathLocks
+
+	// Stop waits on workers for the goroutines started through spawn, none
+	// are started once stopping is set
+	workersMu sync.Mutex
+	stopping  bool
+	workers   sync.WaitGroup
+
+	renameMu       sync.Mutex
+	pendingRenames map[string]*pendingRename
+
+	deleteMu       sync.Mutex
+	deletionTimer  *time.Timer
+	heldDeletions  []Action
+	deletionPrompt func(paths []string)
+
+	retryMu   sync.Mutex
+	retryAt   map[string]time.Time
+	retryChan chan struct{}
+
+	// Pause cancels transferCtx to stop the running transfers, transfers
+	// counts them until they are over
+	transferMu    sync.Mutex
+	paused        bool
+	transferCtx   context.Context
+	stopTransfers context.CancelFunc
+	transfers     int
+	pausedHandler func()
 }
 
-// NewSyncManager creates a new sync manager
-func NewSyncManager(watchDir string) *SyncManager {
-	return &SyncManager{
+// NewSyncManager creates a new sync manager that keeps watchDir in sync with
+// the server through client and records the sync state in store. Settings
+// such as the sync frequency and the remote directory watchDir maps to are
+// read from cfg.
+func NewSyncManager(watchDir string, client *server.Client, store *storage.MetadataStore, cfg *config.Config) *SyncManager {
+	var ignorePatterns, excludedFolders []string
+	var remoteRoot string
+	algorithm := hashing.DefaultAlgorithm
+	if cfg != nil {
+		ignorePatterns = cfg.IgnorePatterns
+		excludedFolders = cfg.GetExcludedFolders()
+		remoteRoot = cfg.RemotePrefix(watchDir)
+
+		parsed, err := hashing.ParseAlgorithm(cfg.HashAlgorithm)
+		if err != nil {
+			fmt.Printf("%v, using %s\n", err, algorithm)
+		} else {
+			algorithm = parsed
+		}
+	}
+
+	// A nil store must not end up as a non-nil cache
+	var cache hashing.Cache
+	if store != nil {
+		cache = store
+	}
+
+	sm := &SyncManager{
 		watchDir:   watchDir,
+		remoteRoot: remoteRoot,
+		client:     client,
+		store:      store,
+		config:     cfg,
+		ignore:     filesystem.NewIgnoreRules(watchDir, ignorePatterns),
+		hasher:     hashing.NewHasher(algorithm, cache, 0),
 		eventChan:  make(chan models.FileEvent),
 		fileInfos:  make(map[string]*models.FileInfo),
 		statusChan: make(chan *models.FileInfo, 100),
+		pollChan:   make(chan struct{}, 1),
+		rescanChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
 		isRunning:  false,
+
+		pendingRenames: make(map[string]*pendingRename),
+
+		retryAt:   make(map[string]time.Time),
+		retryChan: make(chan struct{}, 1),
 	}
+	sm.transferCtx, sm.stopTransfers = context.WithCancel(context.Background())
+	sm.ignore.SetExcluded(sm.localExclusions(excludedFolders))
+
+	return sm
 }
 
 // Start begins the sync manager
 func (sm *SyncManager) Start() error {
-	// Read initial files
-	sm.initialRead()
-
 	if sm.isRunning {
 		return fmt.Errorf("sync manager is already running")
 	}
 
-	// Create and start a watcher
-	watcher, err := filesystem.NewWatcher(sm.watchDir, sm.eventChan)
+	// Changes made while the app was closed are queued first, so they are
+	// listed as not synced and replayed with the rest of the queue
+	if _, _, err := sm.queueLocalChanges(); err != nil {
+		fmt.Printf("failed to detect offline changes in %s: %v\n", sm.watchDir, err)
+	}
+
+	// Manifests of versions replaced since are no longer needed
+	if sm.store != nil {
+		if err := sm.store.PruneManifests(); err != nil {
+			fmt.Printf("failed to prune chunk manifests: %v\n", err)
+		}
+	}
+
+	// Read initial files
+	sm.initialRead()
+
+	// Create and start a watcher, its events reach the sync once they
+	// settled
+	sm.debouncer = filesystem.NewDebouncer(sm.eventChan, filesystem.DefaultQuietPeriod)
+	watcher, err := filesystem.NewWatcher(sm.watcherBackend(), sm.watchDir, sm.debouncer.Events(), sm.ignore, sm.pollInterval())
 	if err != nil {
 		return err
 	}
+	watcher.SetErrorHandler(sm.handleWatcherError)
 
 	sm.watcher = watcher
 	err = sm.watcher.Start()
 	if err != nil {
 		return err
 	}
+	sm.debouncer.Start()
 
 	sm.isRunning = true
 
 	// Start processing events
-	go sm.processEvents()
+	sm.spawn(sm.processEvents)
+
+	// Finish the work interrupted by the last shutdown, then fetch remote
+	// changes now and on every sync interval
+	sm.spawn(func() {
+		sm.replayQueue()
+		sm.pollLoop()
+	})
+	sm.SyncNow()
+
+	// Catch up with changes the watcher missed on every rescan interval
+	sm.spawn(sm.rescanLoop)
+
+	// Pick up the queued work whenever the schedule allows transfers again
+	sm.spawn(sm.scheduleLoop)
+
+	// Try failed files again as their retries fall due
+	sm.spawn(sm.retryLoop)
 
 	return nil
 }
 
-// Stop stops the sync manager
+// Stop stops the sync manager. Running transfers are cancelled and stay
+// queued for the next start, Stop returns once nothing of the sync manager
+// runs anymore.
 func (sm *SyncManager) Stop() {
 	if !sm.isRunning {
 		return
 	}
 
 	sm.isRunning = false
+	sm.workersMu.Lock()
+	sm.stopping = true
+	sm.workersMu.Unlock()
+
+	close(sm.stopChan)
+	sm.transferMu.Lock()
+	sm.stopTransfers()
+	sm.transferMu.Unlock()
+
 	sm.watcher.Stop()
+	sm.debouncer.Stop()
 	close(sm.eventChan)
+	sm.stopRenames()
+
+	sm.workers.Wait()
+}
+
+// spawn runs f in a goroutine Stop waits for, unless the sync manager is
+// stopping
+func (sm *SyncManager) spawn(f func()) {
+	sm.workersMu.Lock()
+	defer sm.workersMu.Unlock()
+
+	if sm.stopping {
+		return
+	}
+	sm.workers.Add(1)
+	go func() {
+		defer sm.workers.Done()
+		f()
+	}()
+}
+
+// WatchDir returns the local directory kept in sync
+func (sm *SyncManager) WatchDir() string {
+	return sm.watchDir
+}
+
+// RemoteRoot returns the server directory the watch directory maps to,
+// empty for the root of the server
+func (sm *SyncManager) RemoteRoot() string {
+	return sm.remoteRoot
+}
+
+// IsRunning reports whether the sync manager was started
+func (sm *SyncManager) IsRunning() bool {
+	return sm.isRunning
+}
+
+// Contains reports whether path is inside the watch directory
+func (sm *SyncManager) Contains(path string) bool {
+	rel, err := sm.remotePath(path)
+	return err == nil && rel != ""
+}
+
+// ContainsRemote reports whether the server path remotePath is synced into
+// the watch directory
+func (sm *SyncManager) ContainsRemote(remotePath string) bool {
+	return sm.remoteRoot == "" || remotePath == sm.remoteRoot || strings.HasPrefix(remotePath, sm.remoteRoot+"/")
+}
+
+// Folder summarizes the sync state of the watch directory
+func (sm *SyncManager) Folder() models.SyncFolder {
+	folder := models.SyncFolder{
+		Path:       sm.watchDir,
+		RemotePath: sm.remoteRoot,
+		Running:    sm.isRunning,
+		Paused:     sm.IsPaused(),
+		Pausing:    sm.IsPausing(),
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var count func(infos map[string]*models.FileInfo)
+	count = func(infos map[string]*models.FileInfo) {
+		for _, info := range infos {
+			folder.Files++
+			switch info.Status {
+			case models.StatusNotSynced, models.StatusSyncing:
+				folder.Pending++
+			case models.StatusError:
+				folder.Errors++
+			case models.StatusConflict:
+				folder.Conflicts++
+			}
+			count(info.FilesContent)
+		}
+	}
+	count(sm.fileInfos)
+
+	return folder
+}
+
+// watcherBackend returns the watcher backend configured for the watch
+// directory
+func (sm *SyncManager) watcherBackend() filesystem.Backend {
+	if sm.config == nil {
+		return filesystem.BackendNative
+	}
+	return filesystem.Backend(sm.config.WatcherBackend(sm.watchDir))
+}
+
+// pollInterval returns the configured interval of the polling watcher
+func (sm *SyncManager) pollInterval() time.Duration {
+	if sm.config == nil || sm.config.PollInterval <= 0 {
+		return filesystem.DefaultPollInterval
+	}
+	return sm.config.PollInterval
 }
 
 // GetFileInfos returns a copy of all file infos
@@ -96,8 +327,14 @@ func (sm *SyncManager) GetStatusChannel() <-chan *models.FileInfo {
 func (sm *SyncManager) processEvents() {
 	for event := range sm.eventChan {
 		switch event.Type {
-		case models.EventCreated, models.EventModified:
+		case models.EventCreated:
+			if !sm.completeRename(event.Path) {
+				sm.handleFileChange(event.Path, event.Timestamp)
+			}
+		case models.EventModified:
 			sm.handleFileChange(event.Path, event.Timestamp)
+		case models.EventRenamed:
+			sm.handleRename(event.Path)
 		case models.EventDeleted:
 			sm.handleFileDelete(event.Path)
 		}
@@ -106,10 +343,12 @@ func (sm *SyncManager) processEvents() {
 
 // handleFileChange processes a file creation or modification
 func (sm *SyncManager) handleFileChange(path string, timestamp time.Time) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	// Leftovers of an interrupted download are never synced
+	if isTempDownload(path) {
+		return
+	}
 
-	// For now, just track the file status
+	sm.mu.Lock()
 	info := &models.FileInfo{
 		Path:         path,
 		Status:       models.StatusNotSynced,
@@ -117,48 +356,47 @@ func (sm *SyncManager) handleFileChange(path string, timestamp time.Time) {
 		IsDownloaded: true, // It's a local file, so it's "downloaded"
 		Version:      1,
 	}
-
 	sm.fileInfos[path] = info
+	sm.mu.Unlock()
 
-	// In a real implementation, you would:
-	// 1. Check if the file exists on the server
-	// 2. Upload the file if needed
-	// 3. Update the status accordingly
-
-	// Mock a sync process
-	go func() {
-		// Update status to syncing
-		sm.updateFileStatus(path, models.StatusSyncing)
+	// Queue the change before syncing so it survives a quit
+	if err := sm.enqueue(path, models.StatusNotSynced); err != nil {
+		fmt.Printf("failed to queue %s: %v\n", path, err)
+	}
 
-		// Simulate sync time
-		time.Sleep(2 * time.Second)
+	sm.spawn(func() { sm.syncFile(path) })
 
-		// Update status to synced
-		sm.updateFileStatus(path, models.StatusSynced)
-	}()
+	if filesystem.IsIgnoreFile(path) {
+		// Files the rules no longer ignore need syncing, those now ignored
+		// must be forgotten
+		sm.SyncNow()
+	}
 }
 
-// handleFileDelete processes a file deletion
+// handleFileDelete processes a file deletion. The deletion reaches the
+// server through the next tree reconciliation, which runs once deletions
+// stop coming in so the mass-delete safety brake sees all of them at once.
 func (sm *SyncManager) handleFileDelete(path string) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	if err := sm.enqueueDeletion(path); err != nil {
+		fmt.Printf("failed to queue deletion of %s: %v\n", path, err)
+	}
+	sm.forgetFile(path)
+	sm.scheduleDeletionCheck()
+}
 
-	// Check if the file exists in our tracking map
-	_, exists := sm.fileInfos[path]
-	if exists {
-		// Remove the file from tracking
-		delete(sm.fileInfos, path)
+// ExplainIgnored tells whether path is left out of the sync and which rule
+// decided it
+func (sm *SyncManager) ExplainIgnored(path string) models.IgnoreMatch {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(sm.watchDir, path)
+	}
 
-		// Send a deleting notification through the status channel
-		sm.statusChan <- &models.FileInfo{
-			Path:   path,
-			Status: models.StatusNotSynced,
-		}
+	isDir := false
+	if stat, err := os.Stat(path); err == nil {
+		isDir = stat.IsDir()
 	}
 
-	// In a real implementation, you would:
-	// 1. Delete the file from the server
-	// 2. Update any relevant tracking information
+	return sm.ignore.Match(filepath.Clean(path), isDir)
 }
 
 // updateFileStatus updates a file's status and notifies listeners
@@ -169,11 +407,20 @@ func (sm *SyncManager) updateFileStatus(path string, status models.SyncStatus) {
 		info.Status = status
 		// Clone the info to avoid race conditions
 		updatedInfo := *info
-		sm.statusChan <- &updatedInfo
+		sm.notify(&updatedInfo)
 	}
 	sm.mu.Unlock()
 }
 
+// notify publishes a status update without blocking when nobody is
+// listening and the channel buffer is full
+func (sm *SyncManager) notify(info *models.FileInfo) {
+	select {
+	case sm.statusChan <- info:
+	default:
+	}
+}
+
 func (sm *SyncManager) initialRead() {
 	// This function is called when the app starts
 	// It reads the initial files in the watch directory
@@ -182,6 +429,29 @@ func (sm *SyncManager) initialRead() {
 
 	var initialContent []*models.FileInfo = make([]*models.FileInfo, 0)
 
+	addContent := func(fileInfo *models.FileInfo) {
+		if !fileInfo.IsDirectory && fileInfo.Path != sm.watchDir {
+
+			filepathDir := filepath.Dir(fileInfo.Path)
+			// Get the file info directory and add this to it's content
+			i := slices.IndexFunc(initialContent, func(e *models.FileInfo) bool {
+				return e.Path == filepathDir
+			})
+
+			if i != -1 {
+				if initialContent[i].FilesContent == nil {
+					initialContent[i].FilesContent = make(map[string]*models.FileInfo)
+				}
+
+				// Add the file to the directory
+				initialContent[i].FilesContent[filepath.Base(fileInfo.Path)] = fileInfo
+				return
+			}
+		}
+
+		initialContent = append(initialContent, fileInfo)
+	}
+
 	filepath.WalkDir(sm.watchDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -191,6 +461,13 @@ func (sm *SyncManager) initialRead() {
 			return nil
 		}
 
+		if sm.ignore.IsIgnored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		info, err := d.Info()
 
 		if err != nil {
@@ -199,45 +476,53 @@ func (sm *SyncManager) initialRead() {
 			return nil
 		}
 
-		name := info.Name()
 		isDir := d.IsDir()
 
 		fileInfo := &models.FileInfo{
 			Path:         path,
-			Status:       models.StatusSynced,
+			Status:       models.StatusNotSynced,
 			LastModified: info.ModTime(),
 			Size:         info.Size(),
 			IsDownloaded: true,
 			IsDirectory:  isDir,
 			Version:      1,
-			LastSynced:   time.Now(),
 		}
 
-		if !isDir && path != sm.watchDir {
-
-			filepathDir := filepath.Dir(path)
-			// Get the file info directory and add this to it's content
-			i := slices.IndexFunc(initialContent, func(e *models.FileInfo) bool {
-				return e.Path == filepathDir
-			})
-
-			if i != -1 {
-				if initialContent[i].FilesContent == nil {
-					initialContent[i].FilesContent = make(map[string]*models.FileInfo)
-				}
-
-				// Add the file to the directory
-				initialContent[i].FilesContent[name] = fileInfo
-
-				return nil
+		// The stored state is what is known about the file, files without
+		// one were never synced
+		if record, err := sm.loadFileInfo(path); err == nil && record != nil {
+			fileInfo.Status = record.Status
+			fileInfo.Version = record.Version
+			fileInfo.Checksum = record.Checksum
+			fileInfo.ChecksumAlgorithm = record.ChecksumAlgorithm
+			fileInfo.LastSynced = record.LastSynced
+			fileInfo.Error = record.Error
+			fileInfo.Retries = record.Retries
+			fileInfo.NextRetry = record.NextRetry
+			if isDir {
+				fileInfo.IsDownloaded = record.IsDownloaded
 			}
 		}
 
-		initialContent = append(initialContent, fileInfo)
+		addContent(fileInfo)
 
 		return nil
 	})
 
+	// Placeholders are listed too, there is nothing of them on disk
+	records, err := sm.listStoredFiles()
+	if err != nil {
+		fmt.Printf("failed to list stored files: %v\n", err)
+	}
+	for _, record := range records {
+		if !isPlaceholder(record) || sm.ignore.IsIgnored(record.Path, false) {
+			continue
+		}
+		if _, err := os.Lstat(record.Path); os.IsNotExist(err) {
+			addContent(record)
+		}
+	}
+
 	sm.fileInfos = make(map[string]*models.FileInfo)
 
 	for _, info := range initialContent {
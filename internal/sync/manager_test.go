@@ -0,0 +1,339 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"homecloud/internal/config"
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+	"homecloud/internal/server/testserver"
+	"homecloud/internal/storage"
+)
+
+// testSetup is a sync manager connected to a test server
+type testSetup struct {
+	manager   *SyncManager
+	client    *server.Client
+	store     *storage.MetadataStore
+	config    *config.Config
+	watchDir  string
+	serverDir string
+	// uploaded counts the bytes received by upload session requests
+	uploaded atomic.Int64
+}
+
+// newTestSetup creates a sync manager for a temporary watch directory,
+// synced with a test server storing its files in another one. The manager
+// is not started.
+func newTestSetup(t *testing.T) *testSetup {
+	t.Helper()
+
+	s := &testSetup{watchDir: t.TempDir(), serverDir: t.TempDir()}
+
+	handler := testserver.New(s.serverDir)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/uploads/") {
+			r.Body = &countingBody{ReadCloser: r.Body, count: &s.uploaded}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s.client = server.NewClient(srv.URL)
+	if err := s.client.Authenticate("user", "password"); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+
+	store, err := storage.NewMetadataStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMetadataStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s.store = store
+
+	s.config = config.DefaultConfig()
+	s.config.WatchDirs = []string{s.watchDir}
+	s.manager = NewSyncManager(s.watchDir, s.client, store, s.config)
+	return s
+}
+
+// start starts the sync manager, it is stopped when the test ends
+func (s *testSetup) start(t *testing.T) {
+	t.Helper()
+
+	if err := s.manager.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(s.manager.Stop)
+}
+
+// synced reports whether the slash-separated paths below the watch directory
+// are all recorded as synced
+func (s *testSetup) synced(paths ...string) bool {
+	for _, path := range paths {
+		record, err := s.store.GetFileInfo(filepath.Join(s.watchDir, filepath.FromSlash(path)))
+		if err != nil || record == nil || record.Status != models.StatusSynced {
+			return false
+		}
+	}
+	return true
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	count *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.count.Add(int64(n))
+	return n, err
+}
+
+// writeFile writes content to the slash-separated path below dir
+func writeFile(t *testing.T, dir, path string, content []byte) {
+	t.Helper()
+
+	path = filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hasContent reports whether the slash-separated path below dir holds
+// content, a nil content meaning that it does not exist
+func hasContent(dir, path string, content []byte) bool {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	if content == nil {
+		return os.IsNotExist(err)
+	}
+	return err == nil && bytes.Equal(data, content)
+}
+
+// eventually fails the test if condition does not hold within a few seconds
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSyncInitial(t *testing.T) {
+	s := newTestSetup(t)
+	writeFile(t, s.watchDir, "local/a.txt", []byte("local"))
+	writeFile(t, s.serverDir, "remote/b.txt", []byte("remote"))
+	writeFile(t, s.watchDir, "both.txt", []byte("same"))
+	writeFile(t, s.serverDir, "both.txt", []byte("same"))
+
+	s.start(t)
+
+	eventually(t, "the local file is uploaded", func() bool {
+		return hasContent(s.serverDir, "local/a.txt", []byte("local"))
+	})
+	eventually(t, "the remote file is downloaded", func() bool {
+		return hasContent(s.watchDir, "remote/b.txt", []byte("remote"))
+	})
+	eventually(t, "every file is synced", func() bool {
+		return s.synced("local/a.txt", "remote/b.txt", "both.txt")
+	})
+}
+
+func TestSyncChanges(t *testing.T) {
+	s := newTestSetup(t)
+	writeFile(t, s.watchDir, "a.txt", []byte("a"))
+	writeFile(t, s.watchDir, "b.txt", []byte("b"))
+	s.start(t)
+	eventually(t, "the files are uploaded", func() bool {
+		return hasContent(s.serverDir, "a.txt", []byte("a")) && hasContent(s.serverDir, "b.txt", []byte("b"))
+	})
+
+	writeFile(t, s.watchDir, "a.txt", []byte("edited locally"))
+	eventually(t, "the local edit is uploaded", func() bool {
+		return hasContent(s.serverDir, "a.txt", []byte("edited locally"))
+	})
+
+	if err := os.Remove(filepath.Join(s.watchDir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the local deletion reaches the server", func() bool {
+		return hasContent(s.serverDir, "b.txt", nil)
+	})
+
+	writeFile(t, s.serverDir, "a.txt", []byte("edited remotely"))
+	s.manager.SyncNow()
+	eventually(t, "the remote edit is downloaded", func() bool {
+		return hasContent(s.watchDir, "a.txt", []byte("edited remotely"))
+	})
+}
+
+func TestSyncOfflineChanges(t *testing.T) {
+	s := newTestSetup(t)
+	writeFile(t, s.watchDir, "edited.txt", []byte("a"))
+	writeFile(t, s.watchDir, "deleted.txt", []byte("b"))
+	writeFile(t, s.watchDir, "kept.txt", []byte("c"))
+	s.start(t)
+	eventually(t, "the files are synced", func() bool {
+		return s.synced("edited.txt", "deleted.txt", "kept.txt")
+	})
+	s.manager.Stop()
+
+	// Changed while the app was closed
+	writeFile(t, s.watchDir, "edited.txt", []byte("edited offline"))
+	if err := os.Remove(filepath.Join(s.watchDir, "deleted.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, s.watchDir, "dir/created.txt", []byte("created offline"))
+
+	s.manager = NewSyncManager(s.watchDir, s.client, s.store, s.config)
+	s.start(t)
+	eventually(t, "the offline changes reach the server", func() bool {
+		return hasContent(s.serverDir, "edited.txt", []byte("edited offline")) &&
+			hasContent(s.serverDir, "deleted.txt", nil) &&
+			hasContent(s.serverDir, "dir/created.txt", []byte("created offline"))
+	})
+	eventually(t, "the files are synced again", func() bool {
+		return s.synced("edited.txt", "dir/created.txt", "kept.txt")
+	})
+	if !hasContent(s.serverDir, "kept.txt", []byte("c")) {
+		t.Error("the unchanged file is gone from the server")
+	}
+}
+
+// running returns the number of running transfers
+func (s *testSetup) running() int {
+	s.manager.transferMu.Lock()
+	defer s.manager.transferMu.Unlock()
+	return s.manager.transfers
+}
+
+func TestStopCancelsTransfers(t *testing.T) {
+	s := newTestSetup(t)
+	s.client.SetBandwidthLimits(64<<10, 0)
+	content := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(content)
+	writeFile(t, s.watchDir, "big", content)
+
+	if err := s.manager.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	eventually(t, "the upload starts", func() bool { return s.running() > 0 })
+
+	s.manager.Stop()
+	if running := s.running(); running != 0 {
+		t.Fatalf("%d transfers still running after Stop()", running)
+	}
+
+	queue, err := s.store.GetSyncQueue()
+	if err != nil {
+		t.Fatalf("GetSyncQueue() error = %v", err)
+	}
+	path := filepath.Join(s.watchDir, "big")
+	if len(queue) != 1 || queue[0].Path != path || queue[0].Status != models.StatusNotSynced {
+		t.Errorf("GetSyncQueue() after Stop() = %v, want %s not synced", queue, path)
+	}
+	if !hasContent(s.serverDir, "big", nil) {
+		t.Error("the cancelled upload reached the server")
+	}
+}
+
+func TestSyncNestedWatchDirRemoved(t *testing.T) {
+	s := newTestSetup(t)
+	nested := t.TempDir()
+	if err := s.config.AddWatchDir(nested, "sub"); err != nil {
+		t.Fatalf("AddWatchDir() error = %v", err)
+	}
+	s.manager.SetExcludedFolders(s.config.GetExcludedFolders())
+
+	writeFile(t, s.serverDir, "sub/a.txt", []byte("nested"))
+	writeFile(t, s.serverDir, "b.txt", []byte("b"))
+	s.start(t)
+	eventually(t, "the remote file is downloaded", func() bool {
+		return hasContent(s.watchDir, "b.txt", []byte("b"))
+	})
+	if !hasContent(s.watchDir, "sub/a.txt", nil) {
+		t.Fatal("the folder synced by the nested watch directory was downloaded")
+	}
+
+	if err := s.config.RemoveWatchDir(nested); err != nil {
+		t.Fatalf("RemoveWatchDir() error = %v", err)
+	}
+	s.manager.SetExcludedFolders(s.config.GetExcludedFolders())
+	eventually(t, "the folder of the removed watch directory syncs again", func() bool {
+		return hasContent(s.watchDir, "sub/a.txt", []byte("nested"))
+	})
+}
+
+func TestSyncResumesUpload(t *testing.T) {
+	s := newTestSetup(t)
+
+	content := make([]byte, server.ChunkSize+1<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	writeFile(t, s.watchDir, "big", content)
+	path := filepath.Join(s.watchDir, "big")
+
+	local, err := s.manager.scanLocalPath(path, nil)
+	if err != nil {
+		t.Fatalf("scanLocalPath() error = %v", err)
+	}
+	info := *local
+	if info.Checksum, err = s.manager.hasher.Checksum(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier run got the first chunk through before being interrupted
+	size := int64(len(content))
+	sessionID, err := s.client.CreateUploadSession("big", size, map[string]string{"checksum": info.Checksum})
+	if err != nil {
+		t.Fatalf("CreateUploadSession() error = %v", err)
+	}
+	if _, err := s.client.UploadChunk(context.Background(), sessionID, 0, bytes.NewReader(content[:server.ChunkSize]), server.ChunkSize); err != nil {
+		t.Fatalf("UploadChunk() error = %v", err)
+	}
+	session := &models.UploadSession{
+		Path:       path,
+		SessionID:  sessionID,
+		RemotePath: "big",
+		Size:       size,
+		Checksum:   info.Checksum,
+		Offset:     server.ChunkSize,
+		UpdatedAt:  time.Now(),
+	}
+	if err := s.store.SaveUploadSession(session); err != nil {
+		t.Fatalf("SaveUploadSession() error = %v", err)
+	}
+	s.uploaded.Store(0)
+
+	if err := s.manager.uploadResumable(context.Background(), path, "big", &info, nil); err != nil {
+		t.Fatalf("uploadResumable() error = %v", err)
+	}
+
+	if !hasContent(s.serverDir, "big", content) {
+		t.Error("server does not have the uploaded content")
+	}
+	if sent, want := s.uploaded.Load(), size-server.ChunkSize; sent != want {
+		t.Errorf("resumed upload sent %d bytes, want the %d not confirmed yet", sent, want)
+	}
+	if session, err := s.store.GetUploadSession(path); err != nil || session != nil {
+		t.Errorf("GetUploadSession() after completion = %v, %v, want none", session, err)
+	}
+}
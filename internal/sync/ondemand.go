@@ -0,0 +1,230 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// isPlaceholder reports whether a record is an online-only file, listed
+// with the server's metadata but without content on disk
+func isPlaceholder(record *models.FileInfo) bool {
+	return record != nil && !record.IsDirectory && !record.IsDownloaded && !record.LastSynced.IsZero()
+}
+
+// placeholderState is the local state of a placeholder, identical to what
+// was last synced
+func placeholderState(path string, base *models.FileInfo) *models.FileInfo {
+	info := *base
+	info.Path = path
+	return &info
+}
+
+// keepOnline reports whether a remote file is only recorded as a
+// placeholder instead of being downloaded. Placeholders stay placeholders
+// and downloaded files stay downloaded, new files follow the folder they
+// are in when on-demand files are enabled. For a directory it tells whether
+// its content is kept online.
+func (sm *SyncManager) keepOnline(localPath string, base *models.FileInfo) bool {
+	if base != nil {
+		return !base.IsDownloaded
+	}
+	if sm.config == nil || !sm.config.IsOnDemand() {
+		return false
+	}
+
+	parent, err := sm.loadFileInfo(filepath.Dir(localPath))
+	return err != nil || parent == nil || !parent.IsDownloaded
+}
+
+// savePlaceholder records a remote file without downloading it
+func (sm *SyncManager) savePlaceholder(localPath string, remote *models.FileInfo) (*models.FileInfo, error) {
+	info := &models.FileInfo{
+		Path:         localPath,
+		Status:       models.StatusSynced,
+		LastModified: remote.LastModified,
+		Size:         remote.Size,
+		IsDownloaded: false,
+		Version:      remote.Version,
+		Checksum:     remote.Checksum,
+		LastSynced:   time.Now(),
+	}
+	info.ChecksumAlgorithm = remote.ChecksumAlgorithm
+	return info, sm.saveFileInfo(info)
+}
+
+// MakeAvailableOffline downloads a placeholder. For a directory every
+// placeholder inside it is downloaded, and so are the files added to it
+// later on.
+func (sm *SyncManager) MakeAvailableOffline(path string) error {
+	path, err := sm.resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	record, err := sm.loadFileInfo(path)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("%s is not synced", path)
+	}
+
+	if !record.IsDirectory {
+		return sm.download(record)
+	}
+
+	records, err := sm.recordsBelow(path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, r := range records {
+		switch {
+		case r.IsDirectory && !r.IsDownloaded:
+			r.IsDownloaded = true
+			errs = append(errs, sm.saveFileInfo(r))
+		case isPlaceholder(r):
+			errs = append(errs, sm.download(r))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolvePath makes a path given by the user absolute, a relative path
+// being inside the watch directory, and rejects paths outside of it
+func (sm *SyncManager) resolvePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(sm.watchDir, path)
+	}
+	if _, err := sm.remotePath(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// download fetches the content of a placeholder
+func (sm *SyncManager) download(record *models.FileInfo) error {
+	if !isPlaceholder(record) {
+		return nil
+	}
+
+	remotePath, err := sm.remotePath(record.Path)
+	if err != nil {
+		return err
+	}
+
+	unlock := sm.locks.lock(remotePath)
+	defer unlock()
+
+	return sm.DownloadFile(remotePath)
+}
+
+// FreeUpSpace turns a downloaded file into a placeholder, deleting its
+// local content while the server keeps it. For a directory every file
+// inside it is evicted, and files added to it later on stay online only.
+// Files with changes not synced yet are kept.
+func (sm *SyncManager) FreeUpSpace(path string) error {
+	path, err := sm.resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	record, err := sm.loadFileInfo(path)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("%s is not synced", path)
+	}
+
+	if !record.IsDirectory {
+		return sm.evict(record)
+	}
+
+	records, err := sm.recordsBelow(path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, r := range records {
+		switch {
+		case r.IsDirectory && r.IsDownloaded:
+			r.IsDownloaded = false
+			errs = append(errs, sm.saveFileInfo(r))
+		case !r.IsDirectory && r.IsDownloaded:
+			errs = append(errs, sm.evict(r))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evict deletes the local content of a synced file and keeps it as a
+// placeholder
+func (sm *SyncManager) evict(record *models.FileInfo) error {
+	if record.IsDirectory || !record.IsDownloaded {
+		return nil
+	}
+
+	remotePath, err := sm.remotePath(record.Path)
+	if err != nil {
+		return err
+	}
+
+	unlock := sm.locks.lock(remotePath)
+	defer unlock()
+
+	stat, err := os.Stat(record.Path)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if record.Status != models.StatusSynced || sm.changedOnDisk(record.Path, stat, record) {
+		return fmt.Errorf("%s has changes that are not synced yet", filepath.Base(record.Path))
+	}
+
+	// The placeholder is recorded first, the deletion must not look like
+	// one made by the user
+	placeholder := *record
+	placeholder.IsDownloaded = false
+	if err := sm.saveFileInfo(&placeholder); err != nil {
+		return err
+	}
+
+	release := sm.suppressEvents(record.Path)
+	defer release()
+
+	if err := os.Remove(record.Path); err != nil && !os.IsNotExist(err) {
+		if saveErr := sm.saveFileInfo(record); saveErr != nil {
+			fmt.Printf("failed to restore record of %s: %v\n", record.Path, saveErr)
+		}
+		return fmt.Errorf("failed to delete %s: %w", filepath.Base(record.Path), err)
+	}
+
+	sm.setFileInfo(&placeholder)
+	return nil
+}
+
+// recordsBelow returns the stored records of dir and of everything inside
+// it
+func (sm *SyncManager) recordsBelow(dir string) ([]*models.FileInfo, error) {
+	records, err := sm.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := dir + string(filepath.Separator)
+	var below []*models.FileInfo
+	for _, record := range records {
+		if record.Path == dir || strings.HasPrefix(record.Path, prefix) {
+			below = append(below, record)
+		}
+	}
+	return below, nil
+}
@@ -0,0 +1,208 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"homecloud/internal/config"
+	"homecloud/internal/models"
+)
+
+// scheduleCheckInterval is how often the sync schedule is checked for a
+// window that opened
+const scheduleCheckInterval = time.Minute
+
+// uploadActions are the actions changing the server, the others of a plan
+// change the local tree
+var uploadActions = map[ActionType]bool{
+	ActionUpload:       true,
+	ActionDeleteRemote: true,
+	ActionRenameRemote: true,
+}
+
+// downloadActions are the actions changing the local tree. A conflict
+// downloads the remote version next to the local one.
+var downloadActions = map[ActionType]bool{
+	ActionDownload:    true,
+	ActionDeleteLocal: true,
+	ActionRenameLocal: true,
+	ActionConflict:    true,
+}
+
+// errPaused is returned by transfers stopped by Pause
+var errPaused = errors.New("sync is paused")
+
+// Pause stops transfers. Those running are cancelled and stay queued, like
+// the changes watched while paused, and everything is synced once resumed.
+// Uploads in chunks or through an upload session continue where they
+// stopped.
+func (sm *SyncManager) Pause() {
+	sm.transferMu.Lock()
+	defer sm.transferMu.Unlock()
+
+	sm.paused = true
+	sm.stopTransfers()
+}
+
+// Resume starts transferring again, beginning with what was queued while
+// paused
+func (sm *SyncManager) Resume() {
+	sm.transferMu.Lock()
+	wasPaused := sm.paused
+	sm.paused = false
+	if wasPaused {
+		sm.transferCtx, sm.stopTransfers = context.WithCancel(context.Background())
+	}
+	sm.transferMu.Unlock()
+
+	if wasPaused && sm.isRunning {
+		sm.spawn(sm.resumeTransfers)
+	}
+}
+
+// IsPaused reports whether transfers are paused
+func (sm *SyncManager) IsPaused() bool {
+	sm.transferMu.Lock()
+	defer sm.transferMu.Unlock()
+
+	return sm.paused
+}
+
+// IsPausing reports whether transfers are paused but some of those that
+// were cancelled have not stopped yet
+func (sm *SyncManager) IsPausing() bool {
+	sm.transferMu.Lock()
+	defer sm.transferMu.Unlock()
+
+	return sm.paused && sm.transfers > 0
+}
+
+// SetPausedHandler registers the function called once the transfers that
+// were running when paused have all stopped
+func (sm *SyncManager) SetPausedHandler(handler func()) {
+	sm.transferMu.Lock()
+	defer sm.transferMu.Unlock()
+
+	sm.pausedHandler = handler
+}
+
+// startTransfer registers a running action. It returns the context its
+// transfers are made with, cancelled by Pause, and the function to call
+// once the action is over.
+func (sm *SyncManager) startTransfer() (context.Context, func()) {
+	sm.transferMu.Lock()
+	defer sm.transferMu.Unlock()
+
+	sm.transfers++
+	return sm.transferCtx, sm.endTransfer
+}
+
+// endTransfer unregisters an action, telling the paused handler when it
+// was the last one running while paused
+func (sm *SyncManager) endTransfer() {
+	sm.transferMu.Lock()
+	sm.transfers--
+	drained := sm.paused && sm.transfers == 0
+	handler := sm.pausedHandler
+	sm.transferMu.Unlock()
+
+	if drained && handler != nil {
+		handler()
+	}
+}
+
+// requeue leaves a file whose transfer was stopped by Pause in the queue,
+// it is synced again once resumed
+func (sm *SyncManager) requeue(path string) error {
+	if err := sm.enqueue(path, models.StatusNotSynced); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if info, exists := sm.fileInfos[path]; exists {
+		info.Status = models.StatusNotSynced
+		updatedInfo := *info
+		sm.notify(&updatedInfo)
+	}
+	return nil
+}
+
+// transferAllowed reports whether an action may run at time now, neither
+// paused nor outside the schedule of its direction
+func (sm *SyncManager) transferAllowed(actionType ActionType, now time.Time) bool {
+	if !uploadActions[actionType] && !downloadActions[actionType] {
+		// Only the store is updated
+		return true
+	}
+	if sm.IsPaused() {
+		return false
+	}
+	if sm.config == nil {
+		return true
+	}
+
+	schedule := sm.config.GetSchedule()
+	if uploadActions[actionType] {
+		return config.InSchedule(schedule.Upload, now)
+	}
+	return config.InSchedule(schedule.Download, now)
+}
+
+// deferAction leaves an action that may not run now for later. Local
+// changes stay queued and are replayed once transfers resume, remote ones
+// are found again by the next check of the server.
+func (sm *SyncManager) deferAction(localPath string, action Action) error {
+	switch action.Type {
+	case ActionUpload:
+		return sm.enqueue(localPath, models.StatusNotSynced)
+	case ActionDeleteRemote:
+		return sm.enqueueDeletion(localPath)
+	case ActionRenameRemote:
+		// Replayed as a deletion and a creation, paired again by inode
+		newLocalPath, err := sm.localPath(action.NewPath)
+		if err != nil {
+			return err
+		}
+		if err := sm.enqueueDeletion(localPath); err != nil {
+			return err
+		}
+		return sm.enqueue(newLocalPath, models.StatusNotSynced)
+	}
+	return nil
+}
+
+// scheduleLoop resumes transfers whenever a window of the schedule opens
+func (sm *SyncManager) scheduleLoop() {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	now := time.Now()
+	uploads := sm.transferAllowed(ActionUpload, now)
+	downloads := sm.transferAllowed(ActionDownload, now)
+
+	for {
+		select {
+		case <-sm.stopChan:
+			return
+		case now = <-ticker.C:
+		}
+
+		wasUploading, wasDownloading := uploads, downloads
+		uploads = sm.transferAllowed(ActionUpload, now)
+		downloads = sm.transferAllowed(ActionDownload, now)
+
+		if (uploads && !wasUploading) || (downloads && !wasDownloading) {
+			sm.resumeTransfers()
+		}
+	}
+}
+
+// resumeTransfers syncs what was left waiting while transfers were not
+// allowed
+func (sm *SyncManager) resumeTransfers() {
+	sm.replayQueue()
+	sm.SyncNow()
+}
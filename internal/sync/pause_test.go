@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"homecloud/internal/models"
+)
+
+// queued returns the paths in the sync queue with status
+func (s *testSetup) queued(t *testing.T, status models.SyncStatus) []string {
+	t.Helper()
+
+	records, err := s.store.GetSyncQueue()
+	if err != nil {
+		t.Fatalf("GetSyncQueue() error = %v", err)
+	}
+	var paths []string
+	for _, record := range records {
+		if record.Status == status {
+			paths = append(paths, record.Path)
+		}
+	}
+	return paths
+}
+
+func TestPauseResume(t *testing.T) {
+	s := newTestSetup(t)
+	paused := make(chan struct{}, 1)
+	s.manager.SetPausedHandler(func() { paused <- struct{}{} })
+
+	s.client.SetBandwidthLimits(64<<10, 0)
+	content := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(content)
+	writeFile(t, s.watchDir, "big", content)
+	big := filepath.Join(s.watchDir, "big")
+
+	s.start(t)
+	eventually(t, "the upload starts", func() bool { return s.running() > 0 })
+
+	s.manager.Pause()
+	eventually(t, "the upload is cancelled", func() bool { return s.running() == 0 })
+	select {
+	case <-paused:
+	case <-time.After(5 * time.Second):
+		t.Error("the paused handler was not called once the upload stopped")
+	}
+	if !s.manager.IsPaused() || s.manager.IsPausing() {
+		t.Errorf("IsPaused() = %v, IsPausing() = %v after the upload stopped, want paused only", s.manager.IsPaused(), s.manager.IsPausing())
+	}
+	if queued := s.queued(t, models.StatusNotSynced); !slices.Contains(queued, big) {
+		t.Errorf("files not synced after Pause() = %q, want %s requeued", queued, big)
+	}
+	if errors := s.queued(t, models.StatusError); len(errors) > 0 {
+		t.Errorf("files failed after Pause() = %q, want none", errors)
+	}
+
+	// Changes made while paused wait in the queue
+	writeFile(t, s.watchDir, "new.txt", []byte("new"))
+	eventually(t, "the new file is queued", func() bool {
+		return slices.Contains(s.queued(t, models.StatusNotSynced), filepath.Join(s.watchDir, "new.txt"))
+	})
+	if !hasContent(s.serverDir, "big", nil) || !hasContent(s.serverDir, "new.txt", nil) {
+		t.Fatal("files were uploaded while paused")
+	}
+
+	s.client.SetBandwidthLimits(0, 0)
+	s.manager.Resume()
+	eventually(t, "the files are uploaded after Resume()", func() bool {
+		return hasContent(s.serverDir, "big", content) && hasContent(s.serverDir, "new.txt", []byte("new"))
+	})
+	eventually(t, "the queue is empty", func() bool {
+		records, err := s.store.GetSyncQueue()
+		return err == nil && len(records) == 0
+	})
+}
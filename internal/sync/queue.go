@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"fmt"
+
+	"homecloud/internal/models"
+)
+
+// enqueue persists that path has work pending, keeping the base state of
+// its record. The sync queue is the files table of the store: a file whose
+// record has any status other than synced is queued. Files are queued before
+// anything is done about them and leave the queue when their record is saved
+// as synced or removed, so work interrupted by a crash or a quit is found
+// again on the next start.
+func (sm *SyncManager) enqueue(path string, status models.SyncStatus) error {
+	if sm.store == nil {
+		return nil
+	}
+
+	record, err := sm.store.GetFileInfo(path)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		record = &models.FileInfo{Path: path, IsDownloaded: true}
+	}
+	record.Status = status
+
+	return sm.store.SaveFileInfo(record)
+}
+
+// enqueueDeletion queues a locally deleted path. Paths without a record
+// were never synced, so there is nothing to delete on the server.
+func (sm *SyncManager) enqueueDeletion(path string) error {
+	if sm.store == nil {
+		return nil
+	}
+
+	record, err := sm.store.GetFileInfo(path)
+	if err != nil || record == nil {
+		return err
+	}
+	record.Status = models.StatusNotSynced
+
+	return sm.store.SaveFileInfo(record)
+}
+
+// settleFile takes a path that needs no action out of the queue. base is
+// its base state, without one the path is gone on both sides.
+func (sm *SyncManager) settleFile(path string, base *models.FileInfo) error {
+	if base == nil {
+		return sm.forgetRecord(path)
+	}
+
+	info := *base
+	info.Status = models.StatusSynced
+	info.Error = ""
+
+	if err := sm.saveFileInfo(&info); err != nil {
+		return err
+	}
+	sm.setFileInfo(&info)
+
+	return nil
+}
+
+// replayQueue resumes the work left unfinished by the last run
+func (sm *SyncManager) replayQueue() {
+	if sm.store == nil {
+		return
+	}
+
+	sm.discardStaleUploads()
+
+	records, err := sm.store.GetSyncQueue()
+	if err != nil {
+		fmt.Printf("failed to load sync queue: %v\n", err)
+		return
+	}
+
+	var paths []string
+	for _, record := range records {
+		// Conflicts wait for the user, not for the sync
+		if record.Status == models.StatusConflict {
+			continue
+		}
+		if _, err := sm.remotePath(record.Path); err != nil {
+			continue
+		}
+		// Failed files keep their backoff across restarts
+		if retryPending(record) {
+			sm.scheduleRetry(record.Path, record.NextRetry)
+			continue
+		}
+		paths = append(paths, record.Path)
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	base, err := sm.loadBaseState()
+	if err != nil {
+		fmt.Printf("failed to load sync state: %v\n", err)
+		return
+	}
+
+	sm.applyPlan(sm.guardDeletions(sm.reconcilePaths(paths), len(base)))
+}
@@ -0,0 +1,283 @@
+package sync
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"homecloud/internal/models"
+)
+
+// ActionType is the kind of operation needed to bring both sides in sync
+type ActionType string
+
+const (
+	ActionUpload       ActionType = "UPLOAD"
+	ActionDownload     ActionType = "DOWNLOAD"
+	ActionDeleteLocal  ActionType = "DELETE_LOCAL"
+	ActionDeleteRemote ActionType = "DELETE_REMOTE"
+	ActionRenameLocal  ActionType = "RENAME_LOCAL"
+	ActionRenameRemote ActionType = "RENAME_REMOTE"
+	ActionConflict     ActionType = "CONFLICT"
+	// ActionRecord updates the base state of a path both sides agree on
+	ActionRecord ActionType = "RECORD"
+	// ActionForget drops the base state of a path gone on both sides
+	ActionForget ActionType = "FORGET"
+)
+
+// Action is a single step of a sync plan. Path is the slash-separated path
+// relative to the sync root, NewPath is the destination of a rename. The
+// states the decision was based on are attached, any of them may be nil.
+type Action struct {
+	Type    ActionType
+	Path    string
+	NewPath string
+	Local   *models.FileInfo
+	Remote  *models.FileInfo
+	Base    *models.FileInfo
+}
+
+// State describes one side of the sync, keyed by relative path
+type State map[string]*models.FileInfo
+
+// Reconcile computes the plan bringing the local and remote trees in sync.
+// base is the last state both sides agreed on, it is what tells a file
+// deleted on one side apart from a file created on the other. Reconcile has
+// no side effects, the returned actions are ordered so they can be applied
+// one after the other.
+func Reconcile(local, remote, base State) []Action {
+	paths := make(map[string]struct{}, len(local)+len(remote)+len(base))
+	for _, state := range []State{local, remote, base} {
+		for path := range state {
+			paths[path] = struct{}{}
+		}
+	}
+
+	var actions []Action
+	for path := range paths {
+		if action, ok := reconcilePath(path, local[path], remote[path], base[path]); ok {
+			actions = append(actions, action)
+		}
+	}
+
+	actions = detectRenames(actions)
+	sortActions(actions)
+
+	return actions
+}
+
+// reconcilePath decides what to do with a single path
+func reconcilePath(path string, l, r, b *models.FileInfo) (Action, bool) {
+	action := Action{Path: path, Local: l, Remote: r, Base: b}
+
+	if b == nil {
+		switch {
+		case l == nil && r == nil:
+			return action, false
+		case r == nil:
+			action.Type = ActionUpload
+		case l == nil:
+			action.Type = ActionDownload
+		case sameContent(l, r):
+			action.Type = ActionRecord
+		default:
+			action.Type = ActionConflict
+		}
+		return action, true
+	}
+
+	localChanged := l != nil && !sameContent(l, b)
+	remoteChanged := r != nil && !sameContent(r, b)
+
+	switch {
+	case l == nil && r == nil:
+		action.Type = ActionForget
+	case l == nil && remoteChanged:
+		// A remote edit wins over a local deletion
+		action.Type = ActionDownload
+	case l == nil:
+		action.Type = ActionDeleteRemote
+	case r == nil && localChanged:
+		// A local edit wins over a remote deletion
+		action.Type = ActionUpload
+	case r == nil:
+		action.Type = ActionDeleteLocal
+	case localChanged && remoteChanged:
+		if sameContent(l, r) {
+			action.Type = ActionRecord
+		} else {
+			action.Type = ActionConflict
+		}
+	case localChanged:
+		action.Type = ActionUpload
+	case remoteChanged:
+		action.Type = ActionDownload
+	default:
+		return action, false
+	}
+
+	return action, true
+}
+
+// sameContent reports whether two states describe the same content.
+// Checksums are compared when both sides have one computed with the same
+// algorithm, otherwise size and modification time are used.
+func sameContent(a, b *models.FileInfo) bool {
+	if a.IsDirectory || b.IsDirectory {
+		return a.IsDirectory == b.IsDirectory
+	}
+	if a.Checksum != "" && b.Checksum != "" && a.ChecksumAlgorithm == b.ChecksumAlgorithm {
+		return a.Checksum == b.Checksum
+	}
+	return a.Size == b.Size && a.LastModified.Unix() == b.LastModified.Unix()
+}
+
+// detectRenames replaces a deletion and a creation of the same file on the
+// same side by a rename. Files are matched by inode first, which also finds
+// moved directories and files that were edited after the move, then by
+// checksum.
+func detectRenames(actions []Action) []Action {
+	renames := func(deleteType, createType, renameType ActionType, created func(Action) *models.FileInfo) {
+		byInode := make(map[uint64][]int)
+		byChecksum := make(map[string][]int)
+		for i, action := range actions {
+			if action.Type != createType || action.Base != nil {
+				continue
+			}
+			info := created(action)
+			if info == nil {
+				continue
+			}
+			if info.Inode != 0 {
+				byInode[info.Inode] = append(byInode[info.Inode], i)
+			}
+			if !info.IsDirectory && info.Checksum != "" {
+				key := checksumKey(info)
+				byChecksum[key] = append(byChecksum[key], i)
+			}
+		}
+
+		// take returns the first creation of the same kind as base that was
+		// not paired yet, or -1
+		take := func(candidates []int, base *models.FileInfo) int {
+			for _, j := range candidates {
+				if actions[j].Type == createType && created(actions[j]).IsDirectory == base.IsDirectory {
+					return j
+				}
+			}
+			return -1
+		}
+
+		for i, action := range actions {
+			if action.Type != deleteType {
+				continue
+			}
+
+			j := -1
+			if action.Base.Inode != 0 {
+				j = take(byInode[action.Base.Inode], action.Base)
+			}
+			if j < 0 && !action.Base.IsDirectory && action.Base.Checksum != "" {
+				j = take(byChecksum[checksumKey(action.Base)], action.Base)
+			}
+			if j < 0 {
+				continue
+			}
+
+			actions[i].Type = renameType
+			actions[i].NewPath = actions[j].Path
+			actions[i].Local = actions[j].Local
+			actions[i].Remote = actions[j].Remote
+			actions[j].Type = ""
+		}
+	}
+
+	// A file that disappeared locally while the same file appeared
+	// elsewhere locally was moved, the server should move it too
+	renames(ActionDeleteRemote, ActionUpload, ActionRenameRemote, func(a Action) *models.FileInfo { return a.Local })
+	// And the other way around for moves made on the server
+	renames(ActionDeleteLocal, ActionDownload, ActionRenameLocal, func(a Action) *models.FileInfo { return a.Remote })
+
+	actions = slices.DeleteFunc(actions, func(a Action) bool { return a.Type == "" })
+	return collapseDirectoryRenames(actions)
+}
+
+// checksumKey identifies content by its checksum and the algorithm of it
+func checksumKey(info *models.FileInfo) string {
+	return info.ChecksumAlgorithm + ":" + info.Checksum
+}
+
+// collapseDirectoryRenames drops the actions made redundant by the rename
+// of a directory. Its descendants move along with it, so only the ones
+// that ended up somewhere else or were edited still need an action, on
+// their new path.
+func collapseDirectoryRenames(actions []Action) []Action {
+	for _, dir := range actions {
+		if (dir.Type != ActionRenameRemote && dir.Type != ActionRenameLocal) || !dir.Base.IsDirectory {
+			continue
+		}
+
+		oldPrefix := dir.Path + "/"
+		for i, action := range actions {
+			if !strings.HasPrefix(action.Path, oldPrefix) {
+				continue
+			}
+			movedPath := dir.NewPath + "/" + strings.TrimPrefix(action.Path, oldPrefix)
+
+			switch {
+			case action.Type == dir.Type && action.NewPath == movedPath:
+				// Moved along with the directory, only an edit made to it
+				// is left to sync
+				switch {
+				case action.Type == ActionRenameRemote && !sameContent(action.Local, action.Base):
+					actions[i] = Action{Type: ActionUpload, Path: movedPath, Local: action.Local, Base: action.Base}
+				case action.Type == ActionRenameLocal && !sameContent(action.Remote, action.Base):
+					actions[i] = Action{Type: ActionDownload, Path: movedPath, Remote: action.Remote, Base: action.Base}
+				default:
+					actions[i].Type = ""
+				}
+			case action.Type == dir.Type, action.Type == ActionDeleteRemote && dir.Type == ActionRenameRemote,
+				action.Type == ActionDeleteLocal && dir.Type == ActionRenameLocal:
+				// By the time this runs the file is already in the moved
+				// directory
+				actions[i].Path = movedPath
+			}
+		}
+	}
+
+	return slices.DeleteFunc(actions, func(a Action) bool { return a.Type == "" })
+}
+
+// actionOrder ranks action types in the order they are applied
+var actionOrder = map[ActionType]int{
+	ActionRecord:       0,
+	ActionForget:       0,
+	ActionRenameLocal:  1,
+	ActionRenameRemote: 1,
+	ActionConflict:     2,
+	ActionUpload:       3,
+	ActionDownload:     3,
+	ActionDeleteLocal:  4,
+	ActionDeleteRemote: 4,
+}
+
+// sortActions orders a plan so renames happen before anything is created at
+// their destination, parents are created before their children and
+// deletions run deepest first, leaving directories empty when removed
+func sortActions(actions []Action) {
+	slices.SortStableFunc(actions, func(a, b Action) int {
+		if c := cmp.Compare(actionOrder[a.Type], actionOrder[b.Type]); c != 0 {
+			return c
+		}
+
+		depth := cmp.Compare(strings.Count(a.Path, "/"), strings.Count(b.Path, "/"))
+		if a.Type == ActionDeleteLocal || a.Type == ActionDeleteRemote {
+			depth = -depth
+		}
+		if depth != 0 {
+			return depth
+		}
+
+		return cmp.Compare(a.Path, b.Path)
+	})
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"homecloud/internal/models"
+)
+
+// file returns the state of a file with content and inode
+func file(content string, inode uint64) *models.FileInfo {
+	return &models.FileInfo{Checksum: content, ChecksumAlgorithm: "sha256", Size: int64(len(content)), Inode: inode}
+}
+
+// dir returns the state of a directory with inode
+func dir(inode uint64) *models.FileInfo {
+	return &models.FileInfo{IsDirectory: true, Inode: inode}
+}
+
+// describe renders a plan as one line per action
+func describe(plan []Action) []string {
+	lines := make([]string, 0, len(plan))
+	for _, action := range plan {
+		line := fmt.Sprintf("%s %s", action.Type, action.Path)
+		if action.NewPath != "" {
+			line += " -> " + action.NewPath
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name                string
+		local, remote, base State
+		want                []string
+	}{
+		{
+			name:   "new on either side without base",
+			local:  State{"a": file("a", 1), "same": file("s", 2), "both": file("l", 3)},
+			remote: State{"b": file("b", 0), "same": file("s", 0), "both": file("r", 0)},
+			want:   []string{"RECORD same", "CONFLICT both", "UPLOAD a", "DOWNLOAD b"},
+		},
+		{
+			name:   "unchanged",
+			local:  State{"a": file("a", 1)},
+			remote: State{"a": file("a", 0)},
+			base:   State{"a": file("a", 1)},
+			want:   []string{},
+		},
+		{
+			name:   "deleted on one side",
+			local:  State{"deleted-remote": file("r", 2)},
+			remote: State{"deleted-local": file("l", 0)},
+			base:   State{"deleted-local": file("l", 1), "deleted-remote": file("r", 2), "gone": file("g", 3)},
+			want:   []string{"FORGET gone", "DELETE_REMOTE deleted-local", "DELETE_LOCAL deleted-remote"},
+		},
+		{
+			name:   "created on one side",
+			local:  State{"a/b": file("ab", 1)},
+			remote: State{"c": file("c", 0)},
+			base:   State{},
+			want:   []string{"DOWNLOAD c", "UPLOAD a/b"},
+		},
+		{
+			name:   "edit wins over delete",
+			local:  State{"edited-local": file("l2", 1)},
+			remote: State{"edited-remote": file("r2", 0)},
+			base:   State{"edited-local": file("l", 1), "edited-remote": file("r", 2)},
+			want:   []string{"UPLOAD edited-local", "DOWNLOAD edited-remote"},
+		},
+		{
+			name:   "changed on both sides",
+			local:  State{"differ": file("l", 1), "agree": file("x", 2)},
+			remote: State{"differ": file("r", 0), "agree": file("x", 0)},
+			base:   State{"differ": file("b", 1), "agree": file("b", 2)},
+			want:   []string{"RECORD agree", "CONFLICT differ"},
+		},
+		{
+			name:   "local rename found by inode",
+			local:  State{"b": file("a2", 1)},
+			remote: State{"a": file("a", 0)},
+			base:   State{"a": file("a", 1)},
+			want:   []string{"RENAME_REMOTE a -> b"},
+		},
+		{
+			name:   "remote rename found by checksum",
+			local:  State{"a": file("a", 1)},
+			remote: State{"b": file("a", 0)},
+			base:   State{"a": file("a", 1)},
+			want:   []string{"RENAME_LOCAL a -> b"},
+		},
+		{
+			name: "directory rename",
+			local: State{
+				"e": dir(10), "e/x": file("x", 11), "e/y": file("y2", 12), "z": file("z", 13),
+			},
+			remote: State{
+				"d": dir(0), "d/x": file("x", 0), "d/y": file("y", 0), "d/z": file("z", 0),
+			},
+			base: State{
+				"d": dir(10), "d/x": file("x", 11), "d/y": file("y", 12), "d/z": file("z", 13),
+			},
+			want: []string{"RENAME_REMOTE d -> e", "RENAME_REMOTE e/z -> z", "UPLOAD e/y"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := describe(Reconcile(test.local, test.remote, test.base))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Reconcile() =\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
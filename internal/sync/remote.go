@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+)
+
+// defaultSyncFrequency is used when the configuration has no valid interval
+const defaultSyncFrequency = 5 * time.Minute
+
+// SyncNow asks for the remote tree to be checked for changes immediately
+func (sm *SyncManager) SyncNow() {
+	select {
+	case sm.pollChan <- struct{}{}:
+	default:
+		// A check is already pending
+	}
+}
+
+// pollLoop checks the server for changes on every sync interval and
+// whenever SyncNow is called
+func (sm *SyncManager) pollLoop() {
+	timer := time.NewTimer(sm.syncFrequency())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-sm.stopChan:
+			return
+		case <-timer.C:
+		case <-sm.pollChan:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		// Nothing could be transferred anyway, the server is checked again
+		// on resume
+		if !sm.IsPaused() {
+			if err := sm.reconcileTree(); err != nil {
+				fmt.Printf("failed to sync with the server: %v\n", err)
+			}
+		}
+
+		// The frequency is read again so configuration changes apply
+		timer.Reset(sm.syncFrequency())
+	}
+}
+
+// syncFrequency returns the configured interval between remote checks
+func (sm *SyncManager) syncFrequency() time.Duration {
+	if sm.config == nil || sm.config.SyncFrequency <= 0 {
+		return defaultSyncFrequency
+	}
+	return sm.config.SyncFrequency
+}
+
+// reconcileTree compares the whole local tree and the remote tree with the
+// last agreed state and applies the resulting plan
+func (sm *SyncManager) reconcileTree() error {
+	if err := sm.ensureRemoteRoot(); err != nil {
+		return err
+	}
+
+	// The base state is loaded first, a transfer finishing while the server
+	// is listed then looks like the same file added on both sides rather
+	// than one deleted on the server
+	base, err := sm.loadBaseState()
+	if err != nil {
+		return err
+	}
+
+	remote, err := sm.listRemoteTree()
+	if err != nil {
+		return err
+	}
+
+	local, err := sm.scanLocalTree(base)
+	if err != nil {
+		return err
+	}
+
+	plan := sm.guardDeletions(sm.withoutPendingRetries(Reconcile(local, remote, base)), len(base))
+	sm.applyPlan(plan)
+	return nil
+}
+
+// ensureRemoteRoot creates the server directory the watch directory maps
+// to when it does not exist yet
+func (sm *SyncManager) ensureRemoteRoot() error {
+	if sm.remoteRoot == "" {
+		return nil
+	}
+
+	_, err := sm.client.GetFileMetadata(sm.remoteRoot)
+	if errors.Is(err, server.ErrNotFound) {
+		return sm.client.CreateDirectory(sm.remoteRoot)
+	}
+	return err
+}
+
+// listRemoteTree walks the server's file tree below the remote root and
+// returns every entry keyed by its remote path
+func (sm *SyncManager) listRemoteTree() (State, error) {
+	return sm.walkRemote(sm.remoteRoot, func(entry *models.FileInfo) bool {
+		localPath, err := sm.localPath(entry.Path)
+		return err != nil || sm.ignore.IsIgnored(localPath, entry.IsDirectory)
+	})
+}
+
+// walkRemote lists the server's file tree below root, leaving out the
+// entries skip returns true for along with their content
+func (sm *SyncManager) walkRemote(root string, skip func(entry *models.FileInfo) bool) (State, error) {
+	tree := make(State)
+	pending := []string{root}
+
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		entries, err := sm.client.ListFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if _, seen := tree[entry.Path]; seen {
+				continue
+			}
+			if skip(entry) {
+				continue
+			}
+			tree[entry.Path] = entry
+
+			if entry.IsDirectory {
+				pending = append(pending, entry.Path)
+			}
+		}
+	}
+
+	return tree, nil
+}
+
+// forgetFile stops tracking a file and notifies listeners
+func (sm *SyncManager) forgetFile(path string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.fileInfos[path]; exists {
+		delete(sm.fileInfos, path)
+		sm.notify(&models.FileInfo{
+			Path:   path,
+			Status: models.StatusNotSynced,
+		})
+	}
+}
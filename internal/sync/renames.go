@@ -0,0 +1,191 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"homecloud/internal/hashing"
+	"homecloud/internal/models"
+	"homecloud/pkg/common"
+)
+
+// renameWindow is how long a file renamed away waits for the creation event
+// of its new name before it is treated as deleted
+const renameWindow = time.Second
+
+// pendingRename is a file that was renamed away and whose new name is not
+// known yet
+type pendingRename struct {
+	base  *models.FileInfo
+	timer *time.Timer
+}
+
+// handleRename processes the rename event of the old name of a file. The
+// watcher reports the new name as a separate creation, the two are paired by
+// completeRename. A rename that is never paired was a move out of the watch
+// directory and ends up as a deletion.
+func (sm *SyncManager) handleRename(path string) {
+	base, err := sm.loadBase(path)
+	if err != nil || base == nil {
+		// Nothing on the server to move
+		sm.handleFileDelete(path)
+		return
+	}
+
+	// Queued like a deletion until the new name shows up
+	if err := sm.enqueueDeletion(path); err != nil {
+		fmt.Printf("failed to queue rename of %s: %v\n", path, err)
+	}
+
+	sm.renameMu.Lock()
+	defer sm.renameMu.Unlock()
+
+	if pending, exists := sm.pendingRenames[path]; exists {
+		pending.timer.Stop()
+	}
+	sm.pendingRenames[path] = &pendingRename{
+		base: base,
+		timer: time.AfterFunc(renameWindow, func() {
+			sm.spawn(func() {
+				sm.renameMu.Lock()
+				_, exists := sm.pendingRenames[path]
+				delete(sm.pendingRenames, path)
+				sm.renameMu.Unlock()
+
+				if exists {
+					sm.handleFileDelete(path)
+				}
+			})
+		}),
+	}
+}
+
+// completeRename pairs a created file with a file renamed away shortly
+// before. The two are the same file if they share an inode, or failing that
+// the same size and checksum. It reports whether newPath was the destination
+// of a pending rename, which is then applied as a server-side move.
+func (sm *SyncManager) completeRename(newPath string) bool {
+	sm.renameMu.Lock()
+	candidates := make(map[string]*models.FileInfo, len(sm.pendingRenames))
+	for path, pending := range sm.pendingRenames {
+		candidates[path] = pending.base
+	}
+	sm.renameMu.Unlock()
+
+	if len(candidates) == 0 {
+		return false
+	}
+
+	stat, err := os.Stat(newPath)
+	if err != nil {
+		return false
+	}
+	fileID := common.FileID(newPath, stat)
+
+	// Computed once per algorithm the candidates were hashed with
+	checksums := make(map[string]string)
+	matches := func(base *models.FileInfo) bool {
+		if base.IsDirectory != stat.IsDir() {
+			return false
+		}
+		if base.Inode != 0 && fileID != 0 {
+			return base.Inode == fileID
+		}
+		if base.IsDirectory || base.Checksum == "" || base.Size != stat.Size() {
+			return false
+		}
+		checksum, ok := checksums[base.ChecksumAlgorithm]
+		if !ok {
+			if checksum, err = sm.hasher.ChecksumWith(newPath, hashing.Algorithm(base.ChecksumAlgorithm)); err != nil {
+				return false
+			}
+			checksums[base.ChecksumAlgorithm] = checksum
+		}
+		return base.Checksum == checksum
+	}
+
+	oldPath := ""
+	for path, base := range candidates {
+		if matches(base) {
+			oldPath = path
+			break
+		}
+	}
+	if oldPath == "" {
+		return false
+	}
+
+	sm.renameMu.Lock()
+	pending, exists := sm.pendingRenames[oldPath]
+	if exists {
+		pending.timer.Stop()
+		delete(sm.pendingRenames, oldPath)
+	}
+	sm.renameMu.Unlock()
+
+	if !exists {
+		// Timed out in the meantime and handled as a deletion
+		return false
+	}
+
+	move := func() {
+		if err := sm.moveFile(oldPath, newPath, pending.base); err != nil {
+			fmt.Printf("failed to move %s: %v\n", oldPath, err)
+		}
+	}
+
+	// The watcher reports the content of a moved directory as created right
+	// after it, by then the records must have moved along or every file would
+	// be uploaded again
+	if pending.base.IsDirectory {
+		move()
+	} else {
+		sm.spawn(move)
+	}
+	return true
+}
+
+// stopRenames stops waiting for the new names of renamed files, their
+// deletion stays queued for the next start
+func (sm *SyncManager) stopRenames() {
+	sm.renameMu.Lock()
+	defer sm.renameMu.Unlock()
+
+	for path, pending := range sm.pendingRenames {
+		pending.timer.Stop()
+		delete(sm.pendingRenames, path)
+	}
+}
+
+// moveFile applies a local rename of a synced file to the server
+func (sm *SyncManager) moveFile(oldPath, newPath string, base *models.FileInfo) error {
+	oldRemotePath, err := sm.remotePath(oldPath)
+	if err != nil {
+		return err
+	}
+	newRemotePath, err := sm.remotePath(newPath)
+	if err != nil {
+		return err
+	}
+
+	local, err := sm.scanLocalPath(newPath, base)
+	if err != nil {
+		return err
+	}
+	if local == nil {
+		// Gone again already, the next reconciliation sorts it out
+		sm.handleFileDelete(oldPath)
+		return nil
+	}
+
+	sm.forgetFile(oldPath)
+
+	return sm.applyAction(Action{
+		Type:    ActionRenameRemote,
+		Path:    oldRemotePath,
+		NewPath: newRemotePath,
+		Local:   local,
+		Base:    base,
+	})
+}
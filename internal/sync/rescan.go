@@ -0,0 +1,210 @@
+package sync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"homecloud/internal/hashing"
+	"homecloud/internal/models"
+	"homecloud/pkg/common"
+)
+
+// defaultRescanInterval is used when the configuration has no valid interval
+const defaultRescanInterval = time.Hour
+
+// Rescan asks for the local tree to be compared with the stored sync state
+// immediately. It catches the changes the watcher missed.
+func (sm *SyncManager) Rescan() {
+	select {
+	case sm.rescanChan <- struct{}{}:
+	default:
+		// A rescan is already pending
+	}
+}
+
+// rescanLoop rescans the local tree on every rescan interval and whenever
+// Rescan is called
+func (sm *SyncManager) rescanLoop() {
+	timer := time.NewTimer(sm.rescanInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-sm.stopChan:
+			return
+		case <-timer.C:
+		case <-sm.rescanChan:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		if err := sm.rescanLocal(); err != nil {
+			fmt.Printf("failed to rescan %s: %v\n", sm.watchDir, err)
+		}
+
+		timer.Reset(sm.rescanInterval())
+	}
+}
+
+// rescanInterval returns the configured interval between local rescans
+func (sm *SyncManager) rescanInterval() time.Duration {
+	if sm.config == nil || sm.config.RescanInterval <= 0 {
+		return defaultRescanInterval
+	}
+	return sm.config.RescanInterval
+}
+
+// handleWatcherError reacts to an error of the watcher. Whatever went wrong,
+// such as its event queue overflowing, events may have been lost.
+func (sm *SyncManager) handleWatcherError(err error) {
+	fmt.Printf("watcher error, rescanning %s: %v\n", sm.watchDir, err)
+	sm.Rescan()
+}
+
+// rescanLocal compares the local tree with the stored sync state, queues
+// every path that changed and syncs them. The server is only contacted for
+// the changed paths.
+func (sm *SyncManager) rescanLocal() error {
+	paths, recorded, err := sm.queueLocalChanges()
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+
+	plan := sm.reconcilePaths(paths)
+	sm.applyPlan(sm.guardDeletions(plan, recorded))
+	return nil
+}
+
+// queueLocalChanges compares the local tree with the stored sync state and
+// queues every path that differs: new and changed files as not synced,
+// recorded files missing from disk as locally deleted. Failed files waiting
+// for a retry are left to the retry loop. It returns the queued paths and
+// the number of stored records.
+func (sm *SyncManager) queueLocalChanges() ([]string, int, error) {
+	records, err := sm.listStoredFiles()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stored := make(map[string]*models.FileInfo, len(records))
+	for _, record := range records {
+		stored[record.Path] = record
+	}
+
+	var changed, deleted []string
+	err = filepath.WalkDir(sm.watchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == sm.watchDir || isTempDownload(path) {
+			return nil
+		}
+		if sm.ignore.IsIgnored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+
+		record := stored[path]
+		delete(stored, path)
+
+		if retryPending(record) {
+			return nil
+		}
+		if sm.changedOnDisk(path, stat, record) {
+			changed = append(changed, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan %s: %w", sm.watchDir, err)
+	}
+
+	// The records left were not found on disk. Placeholders never are,
+	// they are only gone with their directory.
+	for path, record := range stored {
+		if retryPending(record) {
+			continue
+		}
+		if isPlaceholder(record) {
+			if _, err := os.Stat(filepath.Dir(path)); err == nil {
+				continue
+			}
+		}
+		if !sm.isIgnored(path, record) {
+			deleted = append(deleted, path)
+		}
+	}
+
+	for _, path := range changed {
+		if err := sm.enqueue(path, models.StatusNotSynced); err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, path := range deleted {
+		if err := sm.enqueueDeletion(path); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return append(changed, deleted...), len(records), nil
+}
+
+// changedOnDisk reports whether a local file differs from its stored
+// record. Size, modification time and inode are compared first, the content
+// is only hashed when they disagree in a way a touch or a replace by an
+// identical file would explain.
+func (sm *SyncManager) changedOnDisk(path string, stat fs.FileInfo, record *models.FileInfo) bool {
+	if record == nil {
+		return true
+	}
+	if record.Status != models.StatusSynced && record.Status != models.StatusConflict {
+		// Never finished syncing
+		return true
+	}
+	if stat.IsDir() != record.IsDirectory {
+		return true
+	}
+	if stat.IsDir() {
+		return false
+	}
+	if stat.Size() != record.Size {
+		return true
+	}
+
+	inode := common.FileID(path, stat)
+	sameInode := record.Inode == 0 || inode == record.Inode
+	if sameInode && stat.ModTime().Unix() == record.LastModified.Unix() {
+		return false
+	}
+
+	// Hashed like the record was, a record from before another algorithm
+	// was chosen is still compared correctly
+	checksum, err := sm.hasher.ChecksumWith(path, hashing.Algorithm(record.ChecksumAlgorithm))
+	if err != nil || checksum != record.Checksum {
+		return true
+	}
+
+	// Same content, remember the new attributes so it is not hashed again
+	refreshed := *record
+	refreshed.LastModified = stat.ModTime()
+	refreshed.Inode = inode
+	if err := sm.saveFileInfo(&refreshed); err != nil {
+		fmt.Printf("failed to refresh %s: %v\n", path, err)
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+)
+
+// resumableThreshold is the file size from which uploads go through an
+// upload session instead of a single request
+const resumableThreshold = 2 * server.ChunkSize
+
+// uploadResumable uploads a large file in chunks. The session and the offset
+// confirmed by the server are persisted after every chunk, so an interrupted
+// upload continues where it stopped, even after a restart.
+func (sm *SyncManager) uploadResumable(ctx context.Context, path, remotePath string, info *models.FileInfo, metadata map[string]string) error {
+	session, err := sm.resumeUploadSession(path, remotePath, info)
+	if err != nil {
+		return err
+	}
+
+	if session == nil {
+		sessionID, err := sm.client.CreateUploadSession(remotePath, info.Size, metadata)
+		if err != nil {
+			return err
+		}
+
+		session = &models.UploadSession{
+			Path:       path,
+			SessionID:  sessionID,
+			RemotePath: remotePath,
+			Size:       info.Size,
+			Checksum:   info.Checksum,
+			UpdatedAt:  time.Now(),
+		}
+		if sm.store != nil {
+			if err := sm.store.SaveUploadSession(session); err != nil {
+				return err
+			}
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	for session.Offset < session.Size {
+		length := min(int64(server.ChunkSize), session.Size-session.Offset)
+		chunk := io.NewSectionReader(file, session.Offset, length)
+
+		offset, err := sm.client.UploadChunk(ctx, session.SessionID, session.Offset, chunk, length)
+		if err != nil {
+			return err
+		}
+		if offset <= session.Offset {
+			return fmt.Errorf("server did not confirm chunk at offset %d", session.Offset)
+		}
+
+		session.Offset = offset
+		if sm.store != nil {
+			if err := sm.store.UpdateUploadOffset(path, offset); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := sm.client.CompleteUploadSession(session.SessionID); err != nil {
+		return err
+	}
+
+	if sm.store != nil {
+		return sm.store.DeleteUploadSession(path)
+	}
+	return nil
+}
+
+// resumeUploadSession returns the persisted upload session of path if it
+// still matches the file's content and the server still knows about it.
+// Stale sessions are discarded.
+func (sm *SyncManager) resumeUploadSession(path, remotePath string, info *models.FileInfo) (*models.UploadSession, error) {
+	if sm.store == nil {
+		return nil, nil
+	}
+
+	session, err := sm.store.GetUploadSession(path)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	if session.RemotePath == remotePath && session.Size == info.Size && session.Checksum == info.Checksum {
+		// The server is the authority on how much data it actually kept
+		offset, err := sm.client.GetUploadOffset(session.SessionID)
+		if err == nil && offset <= session.Size {
+			session.Offset = offset
+			return session, nil
+		}
+	}
+
+	return nil, sm.store.DeleteUploadSession(path)
+}
+
+// discardStaleUploads drops the upload sessions of files that were removed
+// since their upload was interrupted. Uploads of files still around are
+// picked up again by the sync queue.
+func (sm *SyncManager) discardStaleUploads() {
+	if sm.store == nil {
+		return
+	}
+
+	sessions, err := sm.store.ListUploadSessions()
+	if err != nil {
+		fmt.Printf("failed to list upload sessions: %v\n", err)
+		return
+	}
+
+	for _, session := range sessions {
+		if _, err := sm.remotePath(session.Path); err != nil {
+			// Belongs to another watch directory
+			continue
+		}
+		if _, err := os.Stat(session.Path); err != nil {
+			sm.store.DeleteUploadSession(session.Path)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+)
+
+const (
+	// retryBaseDelay is the wait before the first retry of a failed file,
+	// it doubles with every failed attempt
+	retryBaseDelay = 5 * time.Second
+	// retryMaxDelay caps the wait between retries
+	retryMaxDelay = 30 * time.Minute
+)
+
+// retryDelay returns how long to wait before trying a file again after its
+// retries-th failed attempt with err, and false when err is not worth
+// retrying on its own
+func retryDelay(err error, retries int) (time.Duration, bool) {
+	switch server.Classify(err) {
+	case server.ErrPermanent:
+		return 0, false
+	case server.ErrAuthExpired, server.ErrQuotaExceeded:
+		// They need the user to act, only look again now and then
+		return jitter(retryMaxDelay), true
+	}
+
+	delay := retryMaxDelay
+	if retries < 20 {
+		delay = min(retryBaseDelay<<max(retries-1, 0), retryMaxDelay)
+	}
+
+	// Never sooner than the server asked for
+	return max(jitter(delay), server.RetryAfter(err)), true
+}
+
+// jitter picks a delay in the second half of delay, so files that failed
+// together do not all retry at once
+func jitter(delay time.Duration) time.Duration {
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// scheduleRetry makes the retry loop sync path again at the given time
+func (sm *SyncManager) scheduleRetry(path string, at time.Time) {
+	sm.retryMu.Lock()
+	sm.retryAt[path] = at
+	sm.retryMu.Unlock()
+
+	sm.wakeRetryLoop()
+}
+
+// retryPending reports whether a record failed and waits for a retry, which
+// the retry loop takes care of rather than rescans and replays
+func retryPending(record *models.FileInfo) bool {
+	return record != nil && record.Status == models.StatusError && !record.NextRetry.IsZero()
+}
+
+// withoutPendingRetries leaves the paths waiting for a retry out of a plan,
+// the retry loop syncs them once their retry falls due
+func (sm *SyncManager) withoutPendingRetries(plan []Action) []Action {
+	sm.retryMu.Lock()
+	defer sm.retryMu.Unlock()
+
+	if len(sm.retryAt) == 0 {
+		return plan
+	}
+
+	pending := func(remotePath string) bool {
+		localPath, err := sm.localPath(remotePath)
+		if err != nil {
+			return false
+		}
+		_, scheduled := sm.retryAt[localPath]
+		return scheduled
+	}
+	return slices.DeleteFunc(plan, func(a Action) bool {
+		return pending(a.Path) || (a.NewPath != "" && pending(a.NewPath))
+	})
+}
+
+// RetryNow retries every failed file right away, such as once the user
+// authenticated again
+func (sm *SyncManager) RetryNow() {
+	now := time.Now()
+
+	sm.retryMu.Lock()
+	for path := range sm.retryAt {
+		sm.retryAt[path] = now
+	}
+	sm.retryMu.Unlock()
+
+	sm.wakeRetryLoop()
+}
+
+// wakeRetryLoop makes the retry loop look at the schedule again
+func (sm *SyncManager) wakeRetryLoop() {
+	select {
+	case sm.retryChan <- struct{}{}:
+	default:
+	}
+}
+
+// retryLoop syncs failed files again as their retries fall due. A file
+// failing again is rescheduled with a longer delay.
+func (sm *SyncManager) retryLoop() {
+	timer := time.NewTimer(retryMaxDelay)
+	defer timer.Stop()
+
+	for {
+		next, due := sm.dueRetries(time.Now())
+		if len(due) > 0 {
+			sm.retry(due)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next.IsZero() {
+			timer.Reset(retryMaxDelay)
+		} else {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-sm.stopChan:
+			return
+		case <-sm.retryChan:
+		case <-timer.C:
+		}
+	}
+}
+
+// dueRetries takes the files whose retry is due at now off the schedule,
+// and returns when the next one of the others is due
+func (sm *SyncManager) dueRetries(now time.Time) (time.Time, []string) {
+	sm.retryMu.Lock()
+	defer sm.retryMu.Unlock()
+
+	var next time.Time
+	var due []string
+	for path, at := range sm.retryAt {
+		if !at.After(now) {
+			due = append(due, path)
+			delete(sm.retryAt, path)
+			continue
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next, due
+}
+
+// retry syncs the paths whose retry fell due. Failed deletions are retried
+// through the mass-delete brake like any other plan.
+func (sm *SyncManager) retry(paths []string) {
+	base, err := sm.loadBaseState()
+	if err != nil {
+		fmt.Printf("failed to load sync state: %v\n", err)
+		for _, path := range paths {
+			sm.scheduleRetry(path, time.Now().Add(retryBaseDelay))
+		}
+		return
+	}
+
+	sm.applyPlan(sm.guardDeletions(sm.reconcilePaths(paths), len(base)))
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"homecloud/internal/server"
+)
+
+// statusError returns the error the client gets from a server answering
+// with statusCode, and a Retry-After header unless empty
+func statusError(t *testing.T, statusCode int, retryAfter string) error {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(statusCode)
+	}))
+	defer srv.Close()
+
+	err := server.NewClient(srv.URL).Authenticate("user", "password")
+	if err == nil {
+		t.Fatalf("request answered with status %d succeeded", statusCode)
+	}
+	return err
+}
+
+// checkDelays fails the test unless retryDelay returns a delay between min
+// and max, every time it is asked
+func checkDelays(t *testing.T, err error, retries int, min, max time.Duration) {
+	t.Helper()
+
+	for range 100 {
+		delay, retry := retryDelay(err, retries)
+		if !retry {
+			t.Fatalf("retryDelay(%v, %d) does not retry", err, retries)
+		}
+		if delay < min || delay > max {
+			t.Fatalf("retryDelay(%v, %d) = %v, want between %v and %v", err, retries, delay, min, max)
+		}
+	}
+}
+
+func TestRetryDelayBackoff(t *testing.T) {
+	err := fmt.Errorf("failed to upload file: %w", server.ErrTransient)
+
+	tests := []struct {
+		retries int
+		// The delay before jitter, which takes up to half of it away
+		delay time.Duration
+	}{
+		{0, retryBaseDelay},
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{5, 16 * retryBaseDelay},
+		{9, 256 * retryBaseDelay},
+		// Capped from there on
+		{10, retryMaxDelay},
+		{19, retryMaxDelay},
+		{20, retryMaxDelay},
+		{1000, retryMaxDelay},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.retries), func(t *testing.T) {
+			checkDelays(t, err, test.retries, test.delay/2, test.delay)
+		})
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	seen := make(map[time.Duration]bool)
+	for range 20 {
+		delay, _ := retryDelay(server.ErrTransient, 5)
+		seen[delay] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("retryDelay() returned the same delay every time, want them spread")
+	}
+}
+
+func TestRetryDelayStatus(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		retry      bool
+		min, max   time.Duration
+	}{
+		{http.StatusInternalServerError, true, retryBaseDelay, 2 * retryBaseDelay},
+		{http.StatusServiceUnavailable, true, retryBaseDelay, 2 * retryBaseDelay},
+		{http.StatusRequestTimeout, true, retryBaseDelay, 2 * retryBaseDelay},
+		{http.StatusTooManyRequests, true, retryBaseDelay, 2 * retryBaseDelay},
+		{http.StatusNotFound, true, retryBaseDelay, 2 * retryBaseDelay},
+		{http.StatusConflict, true, retryBaseDelay, 2 * retryBaseDelay},
+		// Waiting for the user, only looked at again now and then
+		{http.StatusUnauthorized, true, retryMaxDelay / 2, retryMaxDelay},
+		{http.StatusInsufficientStorage, true, retryMaxDelay / 2, retryMaxDelay},
+		// Never better by themselves
+		{http.StatusBadRequest, false, 0, 0},
+		{http.StatusForbidden, false, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.statusCode), func(t *testing.T) {
+			err := statusError(t, test.statusCode, "")
+			if !test.retry {
+				if delay, retry := retryDelay(err, 2); retry {
+					t.Errorf("retryDelay(%v) = %v, want no retry", err, delay)
+				}
+				return
+			}
+			checkDelays(t, err, 2, test.min, test.max)
+		})
+	}
+}
+
+func TestRetryDelayRetryAfter(t *testing.T) {
+	// The server asking for longer than the backoff wins
+	err := statusError(t, http.StatusTooManyRequests, "3600")
+	checkDelays(t, err, 1, time.Hour, time.Hour)
+
+	// Shorter only keeps the backoff
+	err = statusError(t, http.StatusServiceUnavailable, "1")
+	checkDelays(t, err, 3, 2*retryBaseDelay, 4*retryBaseDelay)
+}
+
+func TestRetryDelayPermanent(t *testing.T) {
+	if delay, retry := retryDelay(errors.New("failed to open file"), 1); retry {
+		t.Errorf("retryDelay() of a local error = %v, want no retry", delay)
+	}
+}
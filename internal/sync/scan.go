@@ -0,0 +1,215 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+	"homecloud/pkg/common"
+)
+
+// scanLocalPath returns the current state of a local file, or nil if it does
+// not exist. The checksum is only computed when the size or modification
+// time differ from base, so unchanged files are never read. A placeholder
+// is unchanged for as long as its directory exists.
+func (sm *SyncManager) scanLocalPath(path string, base *models.FileInfo) (*models.FileInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		if isPlaceholder(base) {
+			if _, err := os.Stat(filepath.Dir(path)); err == nil {
+				return placeholderState(path, base), nil
+			}
+		}
+		return nil, nil
+	}
+
+	return sm.localState(path, stat, base)
+}
+
+// localState builds the state of a local file from its file info
+func (sm *SyncManager) localState(path string, stat fs.FileInfo, base *models.FileInfo) (*models.FileInfo, error) {
+	info := &models.FileInfo{
+		Path:         path,
+		LastModified: stat.ModTime(),
+		IsDownloaded: true,
+		IsDirectory:  stat.IsDir(),
+		Inode:        common.FileID(path, stat),
+	}
+	if info.IsDirectory {
+		return info, nil
+	}
+
+	info.Size = stat.Size()
+	if base == nil || base.IsDirectory || !sameContent(info, base) {
+		checksum, err := sm.hasher.Checksum(path)
+		if err != nil {
+			return nil, err
+		}
+		info.Checksum = checksum
+		info.ChecksumAlgorithm = string(sm.hasher.Algorithm())
+	}
+
+	return info, nil
+}
+
+// scanLocalTree walks the watch directory and returns its state keyed by
+// remote path
+func (sm *SyncManager) scanLocalTree(base State) (State, error) {
+	local := make(State)
+
+	err := filepath.WalkDir(sm.watchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == sm.watchDir || isTempDownload(path) {
+			return nil
+		}
+		if sm.ignore.IsIgnored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		remotePath, err := sm.remotePath(path)
+		if err != nil {
+			return err
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+
+		info, err := sm.localState(path, stat, base[remotePath])
+		if err != nil {
+			return err
+		}
+		local[remotePath] = info
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", sm.watchDir, err)
+	}
+
+	// Placeholders have nothing on disk, they are there as long as their
+	// directory is
+	for remotePath, b := range base {
+		if _, exists := local[remotePath]; exists || !isPlaceholder(b) {
+			continue
+		}
+		if parent := path.Dir(remotePath); parent == sm.remoteRoot || parent == "." || local[parent] != nil {
+			local[remotePath] = placeholderState(b.Path, b)
+		}
+	}
+
+	return local, nil
+}
+
+// loadBaseState returns the last state both sides agreed on for every path
+// inside the watch directory, keyed by remote path
+func (sm *SyncManager) loadBaseState() (State, error) {
+	records, err := sm.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	base := make(State, len(records))
+	for _, record := range records {
+		if !isBaseRecord(record) {
+			continue
+		}
+		remotePath, err := sm.remotePath(record.Path)
+		if err != nil {
+			continue
+		}
+		base[remotePath] = record
+	}
+	return base, nil
+}
+
+// loadBase returns the base state of a single local path, or nil
+func (sm *SyncManager) loadBase(path string) (*models.FileInfo, error) {
+	record, err := sm.loadFileInfo(path)
+	if err != nil || record == nil || !isBaseRecord(record) {
+		return nil, err
+	}
+	return record, nil
+}
+
+// isBaseRecord reports whether a stored record describes content that was
+// synced at some point. Records of files that never made it to the server
+// carry no base state.
+func isBaseRecord(record *models.FileInfo) bool {
+	return !record.LastSynced.IsZero()
+}
+
+// listStoredFiles returns the stored records of files inside the watch
+// directory
+func (sm *SyncManager) listStoredFiles() ([]*models.FileInfo, error) {
+	if sm.store == nil {
+		return nil, nil
+	}
+
+	all, err := sm.store.ListAllFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*models.FileInfo
+	for _, record := range all {
+		if _, err := sm.remotePath(record.Path); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// remoteEntry returns the server's state of remotePath, or nil if the server
+// has no such file
+func (sm *SyncManager) remoteEntry(remotePath string) (*models.FileInfo, error) {
+	metadata, err := sm.client.GetFileMetadata(remotePath)
+	if err != nil {
+		if errors.Is(err, server.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	info := &models.FileInfo{
+		Path:        remotePath,
+		Status:      models.StatusSynced,
+		IsDirectory: metadata["isDirectory"] == "true",
+		Checksum:    metadata["checksum"],
+		Version:     1,
+	}
+	info.ChecksumAlgorithm = metadata["checksumAlgorithm"]
+	if size, err := strconv.ParseInt(metadata["size"], 10, 64); err == nil {
+		info.Size = size
+	}
+	if version, err := strconv.Atoi(metadata["version"]); err == nil {
+		info.Version = version
+	}
+
+	return info, nil
+}
+
+// singleState returns a State holding info at path, or an empty one if info
+// is nil
+func singleState(path string, info *models.FileInfo) State {
+	if info == nil {
+		return State{}
+	}
+	return State{path: info}
+}
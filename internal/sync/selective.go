@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"homecloud/internal/config"
+	"homecloud/internal/filesystem"
+	"homecloud/internal/hashing"
+	"homecloud/internal/models"
+)
+
+// SetExcludedFolders replaces the server folders selective sync leaves out.
+// Excluded folders are neither downloaded nor scanned, what is already on
+// disk stays there untouched. Folders included again are downloaded right
+// away.
+func (sm *SyncManager) SetExcludedFolders(remotePaths []string) {
+	sm.ignore.SetExcluded(sm.localExclusions(remotePaths))
+
+	if !sm.isRunning {
+		return
+	}
+	if err := sm.watcher.Refresh(); err != nil {
+		fmt.Printf("failed to watch included folders: %v\n", err)
+	}
+	sm.SyncNow()
+}
+
+// localExclusions converts the excluded server folders inside the remote
+// root to paths relative to the watch directory
+func (sm *SyncManager) localExclusions(remotePaths []string) []string {
+	var dirs []string
+	for _, remotePath := range remotePaths {
+		remotePath = config.CleanRemotePath(remotePath)
+		switch {
+		case remotePath == sm.remoteRoot:
+			// Removing the watch directory is how a whole root stops syncing
+		case sm.remoteRoot == "":
+			dirs = append(dirs, remotePath)
+		case strings.HasPrefix(remotePath, sm.remoteRoot+"/"):
+			dirs = append(dirs, strings.TrimPrefix(remotePath, sm.remoteRoot+"/"))
+		}
+	}
+	return dirs
+}
+
+// RemoveLocalCopy deletes the local copy of an excluded server folder. It
+// refuses unless every file in it is on the server with the same content,
+// nothing only present on disk is lost.
+func (sm *SyncManager) RemoveLocalCopy(remotePath string) error {
+	remotePath = config.CleanRemotePath(remotePath)
+	localDir, err := sm.localPath(remotePath)
+	if err != nil {
+		return err
+	}
+
+	match := sm.ignore.Match(localDir, true)
+	if !match.Ignored || match.Source != filesystem.ExcludedSource {
+		// Deleting it would delete it from the server too
+		return fmt.Errorf("%s is still synced, exclude it first", remotePath)
+	}
+
+	remote, err := sm.walkRemote(remotePath, func(*models.FileInfo) bool { return false })
+	if err != nil {
+		return err
+	}
+
+	var unsynced []string
+	err = filepath.WalkDir(localDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if !sm.isOnServer(path, remote) {
+			unsynced = append(unsynced, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check local copy: %w", err)
+	}
+
+	if len(unsynced) > 0 {
+		return fmt.Errorf("%d files in %s are not synced, such as %s", len(unsynced), remotePath, unsynced[0])
+	}
+
+	if err := os.RemoveAll(localDir); err != nil {
+		return fmt.Errorf("failed to remove local copy: %w", err)
+	}
+
+	if err := sm.forgetTree(localDir); err != nil {
+		return fmt.Errorf("failed to forget removed files: %w", err)
+	}
+	return nil
+}
+
+// isOnServer reports whether the local file at path has the same content
+// as its server copy in remote
+func (sm *SyncManager) isOnServer(path string, remote State) bool {
+	remotePath, err := sm.remotePath(path)
+	if err != nil {
+		return false
+	}
+
+	entry, exists := remote[remotePath]
+	if !exists || entry.IsDirectory || entry.Checksum == "" {
+		return false
+	}
+
+	checksum, err := sm.hasher.ChecksumWith(path, hashing.Algorithm(entry.ChecksumAlgorithm))
+	return err == nil && checksum == entry.Checksum
+}
+
+// forgetTree drops the records of dir and of everything below it
+func (sm *SyncManager) forgetTree(dir string) error {
+	records, err := sm.recordsBelow(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := sm.forgetRecord(record.Path); err != nil {
+			return err
+		}
+	}
+
+	prefix := dir + string(filepath.Separator)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for path := range sm.fileInfos {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			delete(sm.fileInfos, path)
+			sm.notify(&models.FileInfo{Path: path, Status: models.StatusNotSynced})
+		}
+	}
+	return nil
+}
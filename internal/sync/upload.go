@@ -0,0 +1,298 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"homecloud/internal/models"
+	"homecloud/internal/server"
+)
+
+// syncFile reconciles a single local path with the server after it changed
+// and applies the resulting actions
+func (sm *SyncManager) syncFile(path string) {
+	sm.applyPlan(sm.reconcilePaths([]string{path}))
+}
+
+// reconcilePaths computes the plan for a set of local paths. Paths found in
+// sync are settled right away and left out of the plan.
+func (sm *SyncManager) reconcilePaths(paths []string) []Action {
+	local, remote, base := make(State), make(State), make(State)
+	localPaths := make(map[string]string, len(paths))
+
+	for _, path := range paths {
+		remotePath, err := sm.remotePath(path)
+		if err != nil {
+			continue
+		}
+
+		b, err := sm.loadBase(path)
+		if err != nil {
+			sm.markFileError(path, err)
+			continue
+		}
+
+		if sm.isIgnored(path, b) {
+			// The rules changed since it was queued
+			if err := sm.forgetRecord(path); err != nil {
+				fmt.Printf("failed to forget %s: %v\n", path, err)
+			}
+			continue
+		}
+
+		l, err := sm.scanLocalPath(path, b)
+		if err != nil {
+			sm.markFileError(path, err)
+			continue
+		}
+
+		r, err := sm.remoteEntry(remotePath)
+		if err != nil {
+			sm.markFileError(path, err)
+			continue
+		}
+
+		if l != nil {
+			local[remotePath] = l
+		}
+		if r != nil {
+			remote[remotePath] = r
+		}
+		if b != nil {
+			base[remotePath] = b
+		}
+		localPaths[remotePath] = path
+	}
+
+	plan := Reconcile(local, remote, base)
+
+	planned := make(map[string]bool, len(plan))
+	for _, action := range plan {
+		planned[action.Path] = true
+		if action.NewPath != "" {
+			planned[action.NewPath] = true
+		}
+	}
+	for remotePath, path := range localPaths {
+		if planned[remotePath] {
+			continue
+		}
+		if err := sm.settleFile(path, base[remotePath]); err != nil {
+			fmt.Printf("failed to settle %s: %v\n", path, err)
+		}
+	}
+
+	return plan
+}
+
+// isIgnored reports whether a local path is left out of the sync. Paths
+// gone from disk are checked as what base says they were.
+func (sm *SyncManager) isIgnored(path string, base *models.FileInfo) bool {
+	isDir := base != nil && base.IsDirectory
+	if stat, err := os.Stat(path); err == nil {
+		isDir = stat.IsDir()
+	}
+	return sm.ignore.IsIgnored(path, isDir)
+}
+
+// uploadFile sends the local content of path to the server and returns the
+// file's new sync state. local is the scanned state of the file, remote and
+// base may be nil. The upload stops when ctx is cancelled.
+func (sm *SyncManager) uploadFile(ctx context.Context, path, remotePath string, local, remote, base *models.FileInfo) (*models.FileInfo, error) {
+	info := *local
+	info.Path = path
+	info.IsDownloaded = true
+	info.Error = ""
+
+	// The new version supersedes everything either side has seen
+	info.Version = 1
+	if base != nil {
+		info.Version = base.Version + 1
+	}
+	if remote != nil && remote.Version >= info.Version {
+		info.Version = remote.Version + 1
+	}
+
+	if info.IsDirectory {
+		if err := sm.client.CreateDirectory(remotePath); err != nil {
+			return nil, err
+		}
+	} else {
+		if info.Checksum == "" || info.ChecksumAlgorithm != string(sm.hasher.Algorithm()) {
+			checksum, err := sm.hasher.Checksum(path)
+			if err != nil {
+				return nil, err
+			}
+			info.Checksum = checksum
+			info.ChecksumAlgorithm = string(sm.hasher.Algorithm())
+		}
+
+		metadata := map[string]string{
+			"checksum":          info.Checksum,
+			"checksumAlgorithm": info.ChecksumAlgorithm,
+			"size":              strconv.FormatInt(info.Size, 10),
+			"lastModified":      info.LastModified.UTC().Format(time.RFC3339),
+			"version":           strconv.Itoa(info.Version),
+		}
+
+		if err := sm.sendContent(ctx, path, remotePath, &info, remote, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	info.Status = models.StatusSynced
+	info.LastSynced = time.Now()
+
+	return &info, sm.saveFileInfo(&info)
+}
+
+// sendContent uploads the content of a file with the cheapest transfer the
+// server supports. A large file the server has a version of goes as a delta
+// of that version, other large files such as new files and copies as the
+// chunks the server is missing. Upload sessions for very large files and
+// single requests for the rest remain for servers supporting neither.
+func (sm *SyncManager) sendContent(ctx context.Context, path, remotePath string, info, remote *models.FileInfo, metadata map[string]string) error {
+	if canTransferDelta(info.Size, remote) {
+		err := sm.uploadDelta(ctx, path, remotePath, info.Size, metadata)
+		if err == nil || errors.Is(err, server.ErrConflict) || ctx.Err() != nil {
+			return err
+		}
+		fmt.Printf("failed to upload %s as a delta: %v\n", path, err)
+	}
+
+	if info.Size >= chunkThreshold {
+		err := sm.uploadChunked(ctx, path, remotePath, info, metadata)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		fmt.Printf("failed to upload %s in chunks, sending it whole: %v\n", path, err)
+	}
+
+	if info.Size >= resumableThreshold {
+		return sm.uploadResumable(ctx, path, remotePath, info, metadata)
+	}
+	return sm.streamFile(ctx, path, remotePath, info.Size, metadata)
+}
+
+// streamFile uploads the content of path without loading it into memory
+func (sm *SyncManager) streamFile(ctx context.Context, path, remotePath string, size int64, metadata map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return sm.client.UploadFile(ctx, remotePath, file, size, metadata, nil)
+}
+
+// remotePath converts a local path inside the watch directory to the
+// slash-separated path used by the server, below the remote root
+func (sm *SyncManager) remotePath(path string) (string, error) {
+	rel, err := filepath.Rel(sm.watchDir, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve remote path: %w", err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of the watch directory", path)
+	}
+
+	rel = filepath.ToSlash(rel)
+	switch {
+	case sm.remoteRoot == "":
+		return rel, nil
+	case rel == ".":
+		return sm.remoteRoot, nil
+	}
+	return sm.remoteRoot + "/" + rel, nil
+}
+
+// loadFileInfo returns the last recorded sync state of path, or nil if the
+// file has never been synced
+func (sm *SyncManager) loadFileInfo(path string) (*models.FileInfo, error) {
+	if sm.store == nil {
+		return nil, nil
+	}
+	return sm.store.GetFileInfo(path)
+}
+
+// saveFileInfo persists the sync state of a file. A synced file starts
+// over with no failed attempts.
+func (sm *SyncManager) saveFileInfo(info *models.FileInfo) error {
+	if info.Status == models.StatusSynced {
+		info.Retries = 0
+		info.NextRetry = time.Time{}
+	}
+	if sm.store == nil {
+		return nil
+	}
+	return sm.store.SaveFileInfo(info)
+}
+
+// setFileInfo replaces the tracked state of a file and notifies listeners
+func (sm *SyncManager) setFileInfo(info *models.FileInfo) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.fileInfos[info.Path] = info
+
+	updatedInfo := *info
+	sm.notify(&updatedInfo)
+}
+
+// markFileError flags a file as failed, records the reason and schedules
+// the next attempt when the error may go away
+func (sm *SyncManager) markFileError(path string, err error) {
+	// Keep the last synced version and checksum on record, only the status,
+	// the reason and the retries change
+	record, loadErr := sm.loadFileInfo(path)
+
+	sm.mu.Lock()
+	info, exists := sm.fileInfos[path]
+	if !exists {
+		info = &models.FileInfo{Path: path, IsDownloaded: true}
+		sm.fileInfos[path] = info
+	}
+
+	retries := info.Retries + 1
+	if loadErr == nil && record != nil {
+		retries = record.Retries + 1
+	}
+	var nextRetry time.Time
+	if delay, retry := retryDelay(err, retries); retry {
+		nextRetry = time.Now().Add(delay)
+	}
+
+	info.Status = models.StatusError
+	info.Error = err.Error()
+	info.Retries = retries
+	info.NextRetry = nextRetry
+
+	updatedInfo := *info
+	sm.notify(&updatedInfo)
+	sm.mu.Unlock()
+
+	if loadErr != nil || record == nil {
+		// Never synced, so there is no base state to keep
+		record = &updatedInfo
+		record.LastSynced = time.Time{}
+	} else {
+		record.Status = models.StatusError
+		record.Error = updatedInfo.Error
+		record.Retries = retries
+		record.NextRetry = nextRetry
+	}
+
+	if saveErr := sm.saveFileInfo(record); saveErr != nil {
+		fmt.Printf("failed to save sync error for %s: %v\n", path, saveErr)
+	}
+
+	if !nextRetry.IsZero() {
+		sm.scheduleRetry(path, nextRetry)
+	}
+}
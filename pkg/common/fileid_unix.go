@@ -0,0 +1,18 @@
+//go:build !windows
+
+package common
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// FileID returns the number identifying a file on its volume, the inode on
+// Unix systems. It survives renames and moves within the volume. Zero means
+// the ID is not available.
+func FileID(path string, info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
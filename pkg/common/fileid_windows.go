@@ -0,0 +1,40 @@
+//go:build windows
+
+package common
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// FileID returns the number identifying a file on its volume, the NTFS file
+// index on Windows. It survives renames and moves within the volume. Zero
+// means the ID is not available.
+func FileID(path string, info fs.FileInfo) uint64 {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0
+	}
+
+	// Backup semantics are required to open directories
+	handle, err := syscall.CreateFile(
+		name,
+		0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_FLAG_BACKUP_SEMANTICS,
+		0,
+	)
+	if err != nil {
+		return 0
+	}
+	defer syscall.CloseHandle(handle)
+
+	var data syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(handle, &data); err != nil {
+		return 0
+	}
+
+	return uint64(data.FileIndexHigh)<<32 | uint64(data.FileIndexLow)
+}
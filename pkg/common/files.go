@@ -1,29 +1,11 @@
 package common
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 )
 
-// CalculateFileChecksum computes the MD5 hash of a file
-func CalculateFileChecksum(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("failed to calculate checksum: %w", err)
-	}
-
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
 // EnsureDirectoryExists creates a directory if it doesn't exist
 func EnsureDirectoryExists(path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {